@@ -3,9 +3,11 @@ package tmux
 import (
 	"anvillm/internal/backend"
 	"anvillm/internal/debug"
+	"anvillm/internal/eventbus"
 	"anvillm/pkg/logging"
 	"anvillm/pkg/sandbox"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
@@ -53,6 +55,7 @@ type Session struct {
 	intentionallyStopped bool // True if user explicitly stopped the session (prevents auto-restart)
 	lastRestartAttempt time.Time // Last time auto-restart was attempted (prevents spam)
 	hadCrash bool // True if session has crashed at least once (enables resume on restart)
+	crashCount int // Number of unexpected crashes detected by Refresh
 	
 	// State machine
 	idleCond *sync.Cond  // Signals when state transitions to idle
@@ -61,10 +64,83 @@ type Session struct {
 	// Callbacks
 	OnStateChange   func(sessionID, oldState, newState string)
 	OnCrashRestart  func(sessionID string) // Called after successful crash recovery restart
+	OnMetadataChange func(sessionID string) // Called after alias, role, context or crash count changes
+	OnEvent         func(sessionID, eventType string, data any) // Called with lifecycle events (eventbus payloads)
 
 	mu sync.Mutex
 }
 
+// Snapshot holds the session fields persisted across daemon restarts.
+type Snapshot struct {
+	ID         string    `json:"id"`
+	Backend    string    `json:"backend"`
+	Cwd        string    `json:"cwd"`
+	Alias      string    `json:"alias,omitempty"`
+	Role       string    `json:"role,omitempty"`
+	Context    string    `json:"context,omitempty"`
+	Sandbox    string    `json:"sandbox,omitempty"`
+	Model      string    `json:"model,omitempty"`
+	State      string    `json:"state"`
+	CreatedAt  time.Time `json:"created_at"`
+	CrashCount int       `json:"crash_count"`
+}
+
+// Snapshot returns the persistable view of the session.
+func (s *Session) Snapshot() Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Snapshot{
+		ID:         s.id,
+		Backend:    s.backendName,
+		Cwd:        s.cwd,
+		Alias:      s.alias,
+		Role:       s.role,
+		Context:    s.context,
+		Sandbox:    s.sandbox,
+		Model:      s.model,
+		State:      s.state,
+		CreatedAt:  s.createdAt,
+		CrashCount: s.crashCount,
+	}
+}
+
+// Restore applies a persisted snapshot to a session recovered from tmux.
+// Fields that tmux window options cannot carry (context, creation time,
+// crash count) are taken from the snapshot; live process state wins over
+// the persisted state except that a saved "running" is kept while the
+// backend process is alive, since the stop hook will report idle later.
+func (s *Session) Restore(snap Snapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !snap.CreatedAt.IsZero() {
+		s.createdAt = snap.CreatedAt
+	}
+	s.context = snap.Context
+	s.crashCount = snap.CrashCount
+	s.hadCrash = snap.CrashCount > 0
+	if s.alias == "" {
+		s.alias = snap.Alias
+	}
+	if s.role == "" {
+		s.role = snap.Role
+	}
+	if s.sandbox == "" {
+		s.sandbox = snap.Sandbox
+	}
+	if s.model == "" {
+		s.model = snap.Model
+	}
+
+	switch {
+	case s.pid == 0:
+		s.state = "stopped"
+		s.intentionallyStopped = snap.State == "stopped"
+	case snap.State == "running":
+		s.state = "running"
+	}
+}
+
 // target returns the tmux target for this window (session:window)
 func (s *Session) target() string {
 	return windowTarget(s.tmuxSession, s.windowName)
@@ -163,6 +239,22 @@ func (s *Session) SetAlias(alias string) {
 	defer s.mu.Unlock()
 	s.alias = alias
 	setWindowOption(s.target(), "ANVILLM_ALIAS", alias)
+	s.notifyMetadataChangeLocked()
+}
+
+// emit fires OnEvent asynchronously, like the other callbacks
+func (s *Session) emit(eventType string, data any) {
+	if s.OnEvent != nil {
+		go s.OnEvent(s.id, eventType, data)
+	}
+}
+
+// notifyMetadataChangeLocked fires OnMetadataChange asynchronously.
+// Caller must hold s.mu.
+func (s *Session) notifyMetadataChangeLocked() {
+	if s.OnMetadataChange != nil {
+		go s.OnMetadataChange(s.id)
+	}
 }
 
 func (s *Session) Metadata() backend.SessionMetadata {
@@ -221,6 +313,7 @@ func (s *Session) SetContext(ctx string) {
 	defer s.mu.Unlock()
 	s.context = ctx
 	s.initialPromptSent = false
+	s.notifyMetadataChangeLocked()
 }
 
 // GetContext gets the startup context (empty after first Send)
@@ -236,6 +329,7 @@ func (s *Session) SetRole(role string) {
 	defer s.mu.Unlock()
 	s.role = role
 	setWindowOption(s.target(), "ANVILLM_ROLE", role)
+	s.notifyMetadataChangeLocked()
 }
 
 // GetRole gets the bot role
@@ -578,31 +672,22 @@ func (s *Session) Restart(ctx context.Context) error {
 	}
 
 	// Reload sandbox config from YAML (picks up any changes)
-	baseCfg, err := sandbox.Load()
-	if err != nil {
-		return fmt.Errorf("failed to load global config: %w", err)
-	}
-	baseLayer := sandbox.LayeredConfig{
-		Filesystem: baseCfg.Filesystem,
-		Network:    baseCfg.Network,
-		Env:        baseCfg.Env,
-	}
-	layers := []sandbox.LayeredConfig{baseLayer}
-
-	backendLayer, err := sandbox.LoadBackend(backendName)
-	if err != nil {
-		return fmt.Errorf("failed to load backend config %q: %w", backendName, err)
-	}
-	layers = append(layers, backendLayer)
-
 	if sbx == "" {
 		sbx = sandbox.DefaultSandbox
 	}
-	sbxLayer, err := sandbox.LoadSandbox(sbx)
+	layers, err := loadSandboxLayers(backendName, sbx)
 	if err != nil {
-		return fmt.Errorf("failed to load sandbox %q: %w", sbx, err)
+		var sbxErr *SandboxError
+		if errors.As(err, &sbxErr) {
+			s.emit(eventbus.EventSandboxLoadFailed, eventbus.SandboxLoadFailed{
+				Backend: backendName,
+				Layer:   sbxErr.Layer,
+				Name:    sbxErr.Name,
+				Error:   sbxErr.Err.Error(),
+			})
+		}
+		return err
 	}
-	layers = append(layers, sbxLayer)
 
 	general := sandbox.GeneralConfig{BestEffort: false, LogLevel: "error"}
 	advanced := sandbox.AdvancedConfig{LDD: false, AddExec: true}
@@ -702,6 +787,13 @@ func (s *Session) Close() error {
 	return nil
 }
 
+// CrashCount returns the number of unexpected crashes detected so far
+func (s *Session) CrashCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.crashCount
+}
+
 // Refresh re-detects state based on process activity
 func (s *Session) Refresh(ctx context.Context) error {
 	s.mu.Lock()
@@ -721,6 +813,8 @@ func (s *Session) Refresh(ctx context.Context) error {
 			
 			// Mark that we had a crash (enables resume on restart)
 			s.hadCrash = true
+			s.crashCount++
+			s.notifyMetadataChangeLocked()
 			
 			// Check if this was an intentional stop
 			if s.intentionallyStopped {
@@ -735,6 +829,10 @@ func (s *Session) Refresh(ctx context.Context) error {
 				debug.Log("[session %s] refresh: skipping auto-restart (too soon since last attempt)", s.id)
 				s.pid = 0
 				s.transitionToLocked("stopped")
+				s.emit(eventbus.EventCrashRestart, eventbus.CrashRestart{
+					CrashCount: s.crashCount,
+					Error:      "too soon since last restart attempt",
+				})
 				return nil
 			}
 			
@@ -752,10 +850,18 @@ func (s *Session) Refresh(ctx context.Context) error {
 				debug.Log("[session %s] refresh: auto-restart failed: %v", s.id, err)
 				s.pid = 0
 				s.transitionToLocked("stopped")
+				s.emit(eventbus.EventCrashRestart, eventbus.CrashRestart{
+					CrashCount: s.crashCount,
+					Error:      err.Error(),
+				})
 				return nil // Don't propagate error - just mark as stopped
 			}
 			
 			debug.Log("[session %s] refresh: auto-restart successful", s.id)
+			s.emit(eventbus.EventCrashRestart, eventbus.CrashRestart{
+				CrashCount: s.crashCount,
+				Restarted:  true,
+			})
 			if onCrashRestart != nil {
 				s.mu.Unlock()
 				onCrashRestart(s.id)
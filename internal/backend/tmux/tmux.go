@@ -124,17 +124,35 @@ func (b *Backend) Name() string {
 	return b.cfg.Name
 }
 
-func (b *Backend) CreateSession(ctx context.Context, opts backend.SessionOptions) (backend.Session, error) {
-	id := generateID()
-	windowName := id // Use session ID as window name
+// SandboxError reports a sandbox configuration layer that failed to load
+type SandboxError struct {
+	Layer string // "global", "backend" or "sandbox"
+	Name  string // "global", the backend name or the sandbox name
+	Err   error
+}
 
-	debug.Log("[session %s] creating window in tmux session %s (sandbox=%s)", id, b.tmuxSession, opts.Sandbox)
+func (e *SandboxError) Error() string {
+	switch e.Layer {
+	case "global":
+		return fmt.Sprintf("failed to load global config: %v", e.Err)
+	case "backend":
+		return fmt.Sprintf("failed to load backend config %q: %v", e.Name, e.Err)
+	default:
+		return fmt.Sprintf("failed to load sandbox %q: %v", e.Name, e.Err)
+	}
+}
 
-	// Build layered sandbox configuration
-	// Start with global.yaml as base
+func (e *SandboxError) Unwrap() error {
+	return e.Err
+}
+
+// loadSandboxLayers loads the sandbox configuration layers for a session:
+// global.yaml, then the backend's config, then the named sandbox. Reloaded
+// on every start, so YAML changes are picked up.
+func loadSandboxLayers(backendName, sbx string) ([]sandbox.LayeredConfig, error) {
 	baseCfg, err := sandbox.Load()
 	if err != nil {
-		return nil, fmt.Errorf("failed to load global config: %w", err)
+		return nil, &SandboxError{Layer: "global", Name: "global", Err: err}
 	}
 
 	// Convert base config to layered format
@@ -145,22 +163,35 @@ func (b *Backend) CreateSession(ctx context.Context, opts backend.SessionOptions
 	}
 	layers := []sandbox.LayeredConfig{baseLayer}
 
-	backendLayer, err := sandbox.LoadBackend(b.cfg.Name)
+	backendLayer, err := sandbox.LoadBackend(backendName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load backend config %q: %w", b.cfg.Name, err)
+		return nil, &SandboxError{Layer: "backend", Name: backendName, Err: err}
 	}
 	layers = append(layers, backendLayer)
 
-	// Add sandbox layer if specified, otherwise use "default"
+	sbxLayer, err := sandbox.LoadSandbox(sbx)
+	if err != nil {
+		return nil, &SandboxError{Layer: "sandbox", Name: sbx, Err: err}
+	}
+	return append(layers, sbxLayer), nil
+}
+
+func (b *Backend) CreateSession(ctx context.Context, opts backend.SessionOptions) (backend.Session, error) {
+	id := generateID()
+	windowName := id // Use session ID as window name
+
+	debug.Log("[session %s] creating window in tmux session %s (sandbox=%s)", id, b.tmuxSession, opts.Sandbox)
+
+	// Build layered sandbox configuration, using the "default" sandbox if
+	// none is specified
 	sbx := opts.Sandbox
 	if sbx == "" {
 		sbx = sandbox.DefaultSandbox
 	}
-	sbxLayer, err := sandbox.LoadSandbox(sbx)
+	layers, err := loadSandboxLayers(b.cfg.Name, sbx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load sandbox %q: %w", sbx, err)
+		return nil, err
 	}
-	layers = append(layers, sbxLayer)
 
 	// Merge layers into final config
 	general := sandbox.GeneralConfig{
@@ -364,9 +395,16 @@ func (b *Backend) ListOrphanedWindows(tracked map[string]bool) []string {
 			continue
 		}
 		// Check if it looks like a session ID (8 hex chars)
-		if len(name) == 8 && isHex(name) && !tracked[name] {
-			orphans = append(orphans, name)
+		if len(name) != 8 || !isHex(name) || tracked[name] {
+			continue
 		}
+		// All backends share one tmux session; only claim windows started
+		// by this backend (or untagged ones) so restarts use the right command.
+		owner := getWindowOption(windowTarget(b.tmuxSession, name), "ANVILLM_BACKEND")
+		if owner != "" && owner != b.cfg.Name {
+			continue
+		}
+		orphans = append(orphans, name)
 	}
 	return orphans
 }
@@ -429,7 +467,12 @@ func (b *Backend) RecoverSession(windowName string) (backend.Session, string, er
 		pid:            pid,
 		state:          "idle",
 		createdAt:      time.Now(),
+		idleSince:      time.Now(),
 		stopCh:         make(chan struct{}),
+		modelResolver:  b.cfg.ModelResolver,
+		clearHandler:   b.cfg.ClearHandler,
+		resumeHandler:  b.cfg.ResumeHandler,
+		compactHandler: b.cfg.CompactHandler,
 		commands:       b.cfg.Commands,
 		stateInspector: b.cfg.StateInspector,
 		backendCommand: b.cfg.Command,
@@ -4,7 +4,9 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 )
 
 var (
@@ -12,6 +14,78 @@ var (
 	// Mounts must be exactly 1 level deep from one of these.
 	// Set via ANVILLM_PROJECT_DIRS (colon-separated), defaults to ~/src:~/prj.
 	ProjectDirs []string
+
+	// MailMaxAttempts is how many times delivery of a message is attempted
+	// before it is moved to the sender's dead-letter folder.
+	// Set via ANVILLM_MAIL_MAX_ATTEMPTS, defaults to 5.
+	MailMaxAttempts = 5
+
+	// MailRetryBackoff is the delay before the first redelivery attempt; it
+	// doubles with every further attempt, up to MailRetryMaxBackoff.
+	// Set via ANVILLM_MAIL_RETRY_BACKOFF (e.g. "30s"), defaults to 10s.
+	MailRetryBackoff = 10 * time.Second
+
+	// MailRetryMaxBackoff caps the delay between delivery attempts.
+	// Set via ANVILLM_MAIL_RETRY_MAX_BACKOFF, defaults to 5m.
+	MailRetryMaxBackoff = 5 * time.Minute
+
+	// MailOverdueNudge prompts an idle recipient again when a request it
+	// received passes respond_by without a response.
+	// Set via ANVILLM_MAIL_OVERDUE_NUDGE (true/false).
+	MailOverdueNudge = true
+
+	// CallTimeout is how long a read on user/call waits for the response
+	// when the request sets no response_timeout/respond_by.
+	// Set via ANVILLM_CALL_TIMEOUT, defaults to 5m.
+	CallTimeout = 5 * time.Minute
+
+	// MailRateLimit is how many messages one agent may deliver to another
+	// within MailRateWindow; further messages wait in the outbox.
+	// Set via ANVILLM_MAIL_RATE_LIMIT (0 disables), defaults to 10.
+	MailRateLimit = 10
+
+	// MailRateWindow is the window for MailRateLimit.
+	// Set via ANVILLM_MAIL_RATE_WINDOW, defaults to 1m.
+	MailRateWindow = time.Minute
+
+	// MailLoopThreshold is how many messages two agents may exchange within
+	// MailLoopWindow, without the user writing to either, before delivery
+	// between them is paused as a loop.
+	// Set via ANVILLM_MAIL_LOOP_THRESHOLD (0 disables), defaults to 20.
+	MailLoopThreshold = 20
+
+	// MailLoopWindow is the window for MailLoopThreshold.
+	// Set via ANVILLM_MAIL_LOOP_WINDOW, defaults to 10m.
+	MailLoopWindow = 10 * time.Minute
+
+	// MailboxRetention is how long the mailbox of a session that is gone
+	// (e.g. not recovered after a restart) is kept after its last change
+	// before it is deleted.
+	// Set via ANVILLM_MAILBOX_RETENTION, defaults to 168h (7 days).
+	MailboxRetention = 7 * 24 * time.Hour
+
+	// MailAttachmentMaxSize is the largest attachment accepted, in bytes.
+	// Set via ANVILLM_MAIL_ATTACHMENT_MAX_SIZE, defaults to 10 MiB.
+	MailAttachmentMaxSize int64 = 10 << 20
+
+	// MailAttachmentMaxCount is how many attachments a message may carry.
+	// Set via ANVILLM_MAIL_ATTACHMENT_MAX_COUNT, defaults to 16.
+	MailAttachmentMaxCount = 16
+
+	// MailAttachmentMaxTotal is the largest combined size of a message's
+	// attachments, in bytes.
+	// Set via ANVILLM_MAIL_ATTACHMENT_MAX_TOTAL, defaults to 32 MiB.
+	MailAttachmentMaxTotal int64 = 32 << 20
+
+	// EventJournalSegment is how many events each event journal segment
+	// holds before a new one is started.
+	// Set via ANVILLM_EVENT_JOURNAL_SEGMENT, defaults to 10000.
+	EventJournalSegment = 10000
+
+	// EventJournalSegments is how many journal segments are kept; older
+	// ones are deleted.
+	// Set via ANVILLM_EVENT_JOURNAL_SEGMENTS, defaults to 10.
+	EventJournalSegments = 10
 )
 
 func init() {
@@ -30,4 +104,51 @@ func init() {
 		}
 		ProjectDirs = append(ProjectDirs, dir)
 	}
+
+	// Invalid values are ignored and the default is kept
+	if n, err := strconv.Atoi(os.Getenv("ANVILLM_MAIL_MAX_ATTEMPTS")); err == nil && n > 0 {
+		MailMaxAttempts = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("ANVILLM_MAIL_RETRY_BACKOFF")); err == nil && d > 0 {
+		MailRetryBackoff = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("ANVILLM_MAIL_RETRY_MAX_BACKOFF")); err == nil && d > 0 {
+		MailRetryMaxBackoff = d
+	}
+	if b, err := strconv.ParseBool(os.Getenv("ANVILLM_MAIL_OVERDUE_NUDGE")); err == nil {
+		MailOverdueNudge = b
+	}
+	if d, err := time.ParseDuration(os.Getenv("ANVILLM_CALL_TIMEOUT")); err == nil && d > 0 {
+		CallTimeout = d
+	}
+	if n, err := strconv.Atoi(os.Getenv("ANVILLM_MAIL_RATE_LIMIT")); err == nil && n >= 0 {
+		MailRateLimit = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("ANVILLM_MAIL_RATE_WINDOW")); err == nil && d > 0 {
+		MailRateWindow = d
+	}
+	if n, err := strconv.Atoi(os.Getenv("ANVILLM_MAIL_LOOP_THRESHOLD")); err == nil && n >= 0 {
+		MailLoopThreshold = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("ANVILLM_MAIL_LOOP_WINDOW")); err == nil && d > 0 {
+		MailLoopWindow = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("ANVILLM_MAILBOX_RETENTION")); err == nil && d >= 0 {
+		MailboxRetention = d
+	}
+	if n, err := strconv.ParseInt(os.Getenv("ANVILLM_MAIL_ATTACHMENT_MAX_SIZE"), 10, 64); err == nil && n > 0 {
+		MailAttachmentMaxSize = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("ANVILLM_MAIL_ATTACHMENT_MAX_COUNT")); err == nil && n > 0 {
+		MailAttachmentMaxCount = n
+	}
+	if n, err := strconv.ParseInt(os.Getenv("ANVILLM_MAIL_ATTACHMENT_MAX_TOTAL"), 10, 64); err == nil && n > 0 {
+		MailAttachmentMaxTotal = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("ANVILLM_EVENT_JOURNAL_SEGMENT")); err == nil && n > 0 {
+		EventJournalSegment = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("ANVILLM_EVENT_JOURNAL_SEGMENTS")); err == nil && n > 0 {
+		EventJournalSegments = n
+	}
 }
@@ -4,23 +4,46 @@
 package eventbus
 
 import (
+	"anvillm/pkg/logging"
 	"encoding/json"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	ps "github.com/simonfxr/pubsub"
+	"go.uber.org/zap"
 )
 
 // Event type constants.
 const (
-	EventStateChange = "StateChange"
-	EventUserRecv    = "UserRecv"
-	EventUserSend    = "UserSend"
-	EventBotRecv     = "BotRecv"
-	EventBotSend     = "BotSend"
-	EventBeadReady   = "BeadReady"   // a bead transitioned to open/ready
-	EventBeadClaimed = "BeadClaimed" // a bead was claimed by an agent
+	EventStateChange      = "StateChange"
+	EventUserRecv         = "UserRecv"
+	EventUserSend         = "UserSend"
+	EventBotRecv          = "BotRecv"
+	EventBotSend          = "BotSend"
+	EventDeliveryFailed   = "DeliveryFailed"   // a message exhausted its delivery attempts
+	EventMessageExpired   = "MessageExpired"   // a message passed expires_at before it was handled
+	EventMessageDelivered = "MessageDelivered" // a message reached its recipient's inbox
+	EventMessageRead      = "MessageRead"      // a recipient read a message for the first time
+	EventMessageCompleted = "MessageCompleted" // a recipient completed a message
+	EventMessageDeleted   = "MessageDeleted"   // a recipient deleted a message without completing it
+	EventResponseReceived = "ResponseReceived" // a response closed a request that expected one
+	EventResponseOverdue  = "ResponseOverdue"  // a request passed respond_by without a response
+	EventMailLoopDetected = "MailLoopDetected" // two agents exchanged too much mail; delivery between them is paused
+	EventBeadReady        = "BeadReady"        // a bead transitioned to open/ready
+	EventBeadClaimed      = "BeadClaimed"      // a bead was claimed by an agent
+	EventEventsDropped    = "EventsDropped"    // a subscriber's buffer overflowed; sent to that subscriber only
+
+	// Session lifecycle; see payloads.go for their data
+	EventSessionCreated    = "SessionCreated"    // a session was started
+	EventSessionKilled     = "SessionKilled"     // a session was killed and removed
+	EventSessionRecovered  = "SessionRecovered"  // a session left by a previous daemon was adopted
+	EventAliasChanged      = "AliasChanged"      // a session's alias was set
+	EventRoleChanged       = "RoleChanged"       // a session's role was set
+	EventContextChanged    = "ContextChanged"    // a session's startup context was set
+	EventCrashRestart      = "CrashRestart"      // a session's process died unexpectedly and was (or could not be) restarted
+	EventSandboxLoadFailed = "SandboxLoadFailed" // a sandbox config layer failed to load, so a session could not start
 )
 
 // allTopic is the single topic used for all events.
@@ -29,6 +52,7 @@ const allTopic = "events"
 // Event is the structure for all published events.
 type Event struct {
 	ID    string `json:"id"`
+	Seq   uint64 `json:"seq"` // monotonically increasing, continued across restarts when journaled
 	TS    int64  `json:"ts"`
 	Source string `json:"source"`
 	Type  string `json:"type"`
@@ -39,6 +63,14 @@ type Event struct {
 // It is safe for concurrent use from multiple goroutines.
 type Bus struct {
 	bus *ps.Bus
+
+	mu      sync.Mutex // orders sequence numbers, the journal and delivery
+	seq     uint64
+	journal *Journal
+
+	subsMu  sync.Mutex // guards subs, separate from mu so stats never wait on delivery
+	subs    []*Subscription
+	lastSub uint64
 }
 
 // New creates a new Bus.
@@ -46,8 +78,26 @@ func New() *Bus {
 	return &Bus{bus: ps.NewBus()}
 }
 
-// Publish emits an event to all current subscribers.
-// It is non-blocking; slow subscribers will have events dropped.
+// SetJournal makes the bus append every event to j before delivering it.
+// Sequence numbers continue after the last journaled event.
+func (b *Bus) SetJournal(j *Journal) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.journal = j
+	b.seq = max(b.seq, j.Last())
+}
+
+// Journal returns the bus's journal, or nil if events are not journaled
+func (b *Bus) Journal() *Journal {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.journal
+}
+
+// Publish emits an event to all current subscribers, in sequence order.
+// It never waits for a subscriber: slow ones have events dropped (and are
+// told how many, see Subscription), and blocking ones queue them for their
+// own delivery goroutine.
 func (b *Bus) Publish(agent, eventType string, data any) {
 	e := &Event{
 		ID:     uuid.New().String(),
@@ -56,20 +106,19 @@ func (b *Bus) Publish(agent, eventType string, data any) {
 		Type:   eventType,
 		Data:   data,
 	}
-	b.bus.Publish(allTopic, e)
-}
 
-// Subscribe returns a read channel that receives *Event values and a cancel
-// function. The channel has a buffer of 64 events; events are dropped when
-// the buffer is full (slow consumer). Calling cancel removes the subscription
-// and closes the channel.
-func (b *Bus) Subscribe() (<-chan *Event, func()) {
-	ch := make(chan *Event, 64)
-	sub := b.bus.SubscribeChan(allTopic, ch, ps.CloseOnUnsubscribe)
-	cancel := func() {
-		b.bus.Unsubscribe(sub)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.seq++
+	e.Seq = b.seq
+	if b.journal != nil {
+		// Journal failures must not stop delivery; the event is just
+		// missing from replays
+		if err := b.journal.append(e.Seq, MarshalEvent(e)); err != nil {
+			logging.Logger().Warn("failed to journal event", zap.Uint64("seq", e.Seq), zap.Error(err))
+		}
 	}
-	return ch, cancel
+	b.bus.Publish(allTopic, e)
 }
 
 // MarshalEvent encodes an event as a JSON line (with trailing newline).
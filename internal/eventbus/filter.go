@@ -0,0 +1,68 @@
+package eventbus
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Filter selects events by type and source. An empty list matches
+// anything; otherwise an event must match one of the listed values. A
+// source also matches the sources below it, so "beads" selects
+// "beads/myproject".
+type Filter struct {
+	Types   []string
+	Sources []string
+}
+
+// ParseFilter parses a filter expression: space-separated key=value terms
+// with comma-separated alternatives, e.g. "type=StateChange,UserRecv
+// source=a1b2c3d4". All terms must match. An empty expression matches every
+// event.
+func ParseFilter(expr string) (Filter, error) {
+	var f Filter
+	for _, term := range strings.Fields(expr) {
+		key, value, ok := strings.Cut(term, "=")
+		if !ok || value == "" {
+			return f, fmt.Errorf("invalid filter term %q: expected key=value", term)
+		}
+		values := strings.Split(value, ",")
+		switch key {
+		case "type":
+			f.Types = append(f.Types, values...)
+		case "source":
+			f.Sources = append(f.Sources, values...)
+		default:
+			return f, fmt.Errorf("unknown filter key %q (use type, source)", key)
+		}
+	}
+	return f, nil
+}
+
+// Match reports whether an event with the given type and source passes
+func (f Filter) Match(eventType, source string) bool {
+	if len(f.Types) > 0 && !slices.Contains(f.Types, eventType) {
+		return false
+	}
+	if len(f.Sources) > 0 {
+		for _, s := range f.Sources {
+			if source == s || strings.HasPrefix(source, s+"/") {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// String formats the filter as an expression ParseFilter accepts
+func (f Filter) String() string {
+	var terms []string
+	if len(f.Types) > 0 {
+		terms = append(terms, "type="+strings.Join(f.Types, ","))
+	}
+	if len(f.Sources) > 0 {
+		terms = append(terms, "source="+strings.Join(f.Sources, ","))
+	}
+	return strings.Join(terms, " ")
+}
@@ -0,0 +1,343 @@
+package eventbus
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// segmentExt is the extension of journal segment files. Each segment is
+// named after the sequence number of its first event, zero-padded so the
+// names sort in sequence order.
+const segmentExt = ".jsonl"
+
+// Journal is an on-disk log of published events, one JSON line per event
+// (as MarshalEvent writes them) in sequence order. It lets consumers resume
+// from the last sequence number they saw. The log is split into segment
+// files of a fixed number of events, and only the newest segments are kept.
+// Segments are synced to disk when full and on Close; after a crash the
+// newest one may lack its last events, and an incomplete last line is cut
+// off when the journal is reopened.
+type Journal struct {
+	dir        string
+	perSegment int // events per segment
+	keep       int // segments kept
+	mu         sync.Mutex
+	f          *os.File // newest segment, nil until the first append
+	segments   []uint64 // first sequence number of each segment, oldest first
+	count      int      // events in the newest segment
+	last       uint64   // sequence number of the last journaled event
+}
+
+// GapError is returned by Journal.Since when events after the requested
+// sequence number have already been pruned from the journal
+type GapError struct {
+	After  uint64 // the requested sequence number
+	Oldest uint64 // the oldest sequence number still journaled
+}
+
+func (e *GapError) Error() string {
+	return fmt.Sprintf("gap: events %d-%d were pruned from the journal, the oldest kept is %d",
+		e.After+1, e.Oldest-1, e.Oldest)
+}
+
+// OpenJournal opens (or creates) the journal in dir, starting a new segment
+// every perSegment events and keeping the newest keep segments. Only the
+// newest segment is read, to find where numbering continues.
+func OpenJournal(dir string, perSegment, keep int) (*Journal, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	j := &Journal{dir: dir, perSegment: max(perSegment, 1), keep: max(keep, 1)}
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), segmentExt)
+		if !ok {
+			continue
+		}
+		if start, err := strconv.ParseUint(name, 10, 64); err == nil && start > 0 {
+			j.segments = append(j.segments, start)
+		}
+	}
+	slices.Sort(j.segments)
+	if len(j.segments) == 0 {
+		return j, nil
+	}
+
+	start := j.segments[len(j.segments)-1]
+	path := j.segmentPath(start)
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	// Drop a last line left incomplete by a crash, so the next event is
+	// not appended onto it
+	if end := bytes.LastIndexByte(data, '\n') + 1; end < len(data) {
+		if err := f.Truncate(int64(end)); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("truncate %s: %w", path, err)
+		}
+		data = data[:end]
+	}
+	j.f, j.last = f, start-1
+	for _, line := range bytes.Split(data, []byte{'\n'}) {
+		if h, ok := parseHeader(line); ok {
+			j.count++
+			j.last = max(j.last, h.Seq)
+		}
+	}
+	j.pruneLocked()
+	return j, nil
+}
+
+// Last returns the sequence number of the newest journaled event
+func (j *Journal) Last() uint64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.last
+}
+
+// append writes one encoded event, starting a new segment when the newest
+// one is full. The caller assigns sequence numbers in order (Bus.Publish
+// does, under its lock).
+func (j *Journal) append(seq uint64, line []byte) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.f == nil || j.count >= j.perSegment {
+		f, err := os.OpenFile(j.segmentPath(seq), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		if j.f != nil {
+			// The full segment is never written again
+			j.f.Sync()
+			j.f.Close()
+		}
+		j.f, j.count = f, 0
+		j.segments = append(j.segments, seq)
+		j.pruneLocked()
+	}
+	if _, err := j.f.Write(line); err != nil {
+		return err
+	}
+	j.count++
+	j.last = seq
+	return nil
+}
+
+// pruneLocked deletes the oldest segments beyond the retention cap. Caller
+// must hold j.mu.
+func (j *Journal) pruneLocked() {
+	for len(j.segments) > j.keep {
+		os.Remove(j.segmentPath(j.segments[0]))
+		j.segments = j.segments[1:]
+	}
+}
+
+// segmentPath returns the file of the segment starting at start
+func (j *Journal) segmentPath(start uint64) string {
+	return filepath.Join(j.dir, fmt.Sprintf("%020d%s", start, segmentExt))
+}
+
+// segmentFor returns the segment holding the event after seq, or the
+// oldest segment for seq 0. ok is false if that event was pruned or the
+// journal is empty.
+func (j *Journal) segmentFor(seq uint64) (start uint64, ok bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if len(j.segments) == 0 {
+		return 0, false
+	}
+	if seq == 0 {
+		return j.segments[0], true
+	}
+	if seq+1 < j.segments[0] {
+		return j.segments[0], false
+	}
+	for _, s := range j.segments {
+		if s > seq+1 {
+			break
+		}
+		start = s
+	}
+	return start, true
+}
+
+// segmentAfter returns the oldest segment newer than start
+func (j *Journal) segmentAfter(start uint64) (uint64, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, s := range j.segments {
+		if s > start {
+			return s, true
+		}
+	}
+	return 0, false
+}
+
+// Close closes the journal file
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.f == nil {
+		return nil
+	}
+	if err := j.f.Sync(); err != nil {
+		j.f.Close()
+		return err
+	}
+	return j.f.Close()
+}
+
+// Since opens a reader over the journaled events after seq that pass f. It
+// returns a *GapError if some of them were already pruned; seq 0 reads
+// from the oldest event kept.
+func (j *Journal) Since(seq uint64, f Filter) (*JournalReader, error) {
+	r := &JournalReader{j: j, after: seq, filter: f}
+	start, ok := j.segmentFor(seq)
+	if !ok && start > 0 {
+		return nil, &GapError{After: seq, Oldest: start}
+	}
+	if ok {
+		if err := r.open(start); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// JournalReader reads journaled events in order, like tail -f: at the end
+// of the journal Next reports nothing, and later calls pick up events
+// appended since, moving on to newer segments as they are started.
+type JournalReader struct {
+	j       *Journal
+	start   uint64 // segment being read; 0 before the journal has any
+	f       *os.File
+	r       *bufio.Reader
+	partial []byte // start of a line still being written
+	sealed  bool   // a newer segment exists, so this one is complete
+	after   uint64 // skip events up to this sequence number
+	filter  Filter
+}
+
+// open switches the reader to the segment starting at start
+func (r *JournalReader) open(start uint64) error {
+	f, err := os.Open(r.j.segmentPath(start))
+	if err != nil {
+		return err
+	}
+	if r.f != nil {
+		r.f.Close()
+	}
+	r.start, r.f, r.r = start, f, bufio.NewReader(f)
+	r.partial, r.sealed = nil, false
+	return nil
+}
+
+// advance moves to the next segment once the current one is read to its
+// end. It reports false if there is nothing newer to read yet.
+func (r *JournalReader) advance() bool {
+	if r.f == nil {
+		start, ok := r.j.segmentAfter(0)
+		return ok && r.open(start) == nil
+	}
+	next, ok := r.j.segmentAfter(r.start)
+	if !ok {
+		return false
+	}
+	if !r.sealed {
+		// Events may have been appended after the EOF just seen and
+		// before the new segment was started: read to the end once more
+		r.sealed = true
+		return true
+	}
+	// A segment pruned before it was opened is skipped; the jump in
+	// sequence numbers shows the gap
+	for r.open(next) != nil {
+		if next, ok = r.j.segmentAfter(next); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Next returns the next event line (with trailing newline) or false at the
+// current end of the journal
+func (r *JournalReader) Next() ([]byte, bool) {
+	for {
+		if r.f == nil {
+			if !r.advance() {
+				return nil, false
+			}
+			continue
+		}
+		chunk, err := r.r.ReadBytes('\n')
+		if err != nil {
+			// At EOF, keep an incomplete last line until the rest is written
+			r.partial = append(r.partial, chunk...)
+			if !r.advance() {
+				return nil, false
+			}
+			continue
+		}
+		line := chunk
+		if len(r.partial) > 0 {
+			line = append(r.partial, chunk...)
+			r.partial = nil
+		}
+		h, ok := parseHeader(line)
+		if !ok || h.Seq <= r.after {
+			continue
+		}
+		r.after = h.Seq
+		if !r.filter.Match(h.Type, h.Source) {
+			continue
+		}
+		return line, true
+	}
+}
+
+// SetFilter replaces the filter applied to events not yet read
+func (r *JournalReader) SetFilter(f Filter) {
+	r.filter = f
+}
+
+// Close closes the reader
+func (r *JournalReader) Close() error {
+	if r.f == nil {
+		return nil
+	}
+	return r.f.Close()
+}
+
+// header is the part of a journal line needed to position and filter
+type header struct {
+	Seq    uint64 `json:"seq"`
+	Type   string `json:"type"`
+	Source string `json:"source"`
+}
+
+// parseHeader decodes the header of a journal line
+func parseHeader(line []byte) (header, bool) {
+	var h header
+	if err := json.Unmarshal(bytes.TrimSpace(line), &h); err != nil || h.Seq == 0 {
+		return h, false
+	}
+	return h, true
+}
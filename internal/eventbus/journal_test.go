@@ -0,0 +1,151 @@
+package eventbus
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// publishN publishes n events through a bus journaling to j
+func publishN(t *testing.T, j *Journal, n int) {
+	t.Helper()
+	b := New()
+	b.SetJournal(j)
+	for i := 0; i < n; i++ {
+		b.Publish("test", EventStateChange, i)
+	}
+}
+
+// readAll returns the sequence numbers a reader yields
+func readAll(r *JournalReader) []uint64 {
+	var seqs []uint64
+	for {
+		line, ok := r.Next()
+		if !ok {
+			return seqs
+		}
+		h, _ := parseHeader(line)
+		seqs = append(seqs, h.Seq)
+	}
+}
+
+func TestOpenJournalTruncatesPartialLine(t *testing.T) {
+	dir := t.TempDir()
+	j, err := OpenJournal(dir, 100, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publishN(t, j, 3)
+	j.Close()
+
+	// A crash in the middle of writing event 4
+	path := filepath.Join(dir, "00000000000000000001.jsonl")
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"id":"x","seq":4,"ty`)
+	f.Close()
+
+	j, err = OpenJournal(dir, 100, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	if j.Last() != 3 {
+		t.Fatalf("Last() = %d, want 3", j.Last())
+	}
+	publishN(t, j, 1)
+
+	r, err := j.Since(0, Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	got := readAll(r)
+	if len(got) != 4 || got[3] != 4 {
+		t.Errorf("read %v, want [1 2 3 4]", got)
+	}
+}
+
+func TestJournalSince(t *testing.T) {
+	dir := t.TempDir()
+	// Segments start at 1, 4, 7 and 10; only 7 and 10 are kept
+	j, err := OpenJournal(dir, 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publishN(t, j, 10)
+	j.Close()
+	if _, err := os.Stat(filepath.Join(dir, "00000000000000000004.jsonl")); !os.IsNotExist(err) {
+		t.Fatalf("segment 4 not pruned: %v", err)
+	}
+
+	// Reopened, as after a restart
+	j, err = OpenJournal(dir, 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	tests := []struct {
+		since uint64
+		want  []uint64
+		gap   bool // events after since were pruned
+	}{
+		{since: 0, want: []uint64{7, 8, 9, 10}},
+		{since: 3, gap: true},
+		{since: 5, gap: true},
+		{since: 6, want: []uint64{7, 8, 9, 10}},
+		{since: 8, want: []uint64{9, 10}},
+		{since: 10},
+	}
+	for _, tt := range tests {
+		r, err := j.Since(tt.since, Filter{})
+		if tt.gap {
+			var gap *GapError
+			if !errors.As(err, &gap) || gap.After != tt.since || gap.Oldest != 7 {
+				t.Errorf("Since(%d): got %v, want a gap up to 7", tt.since, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Since(%d): %v", tt.since, err)
+			continue
+		}
+		if got := readAll(r); !slices.Equal(got, tt.want) {
+			t.Errorf("Since(%d) read %v, want %v", tt.since, got, tt.want)
+		}
+		r.Close()
+	}
+}
+
+func TestJournalReaderFollows(t *testing.T) {
+	j, err := OpenJournal(t.TempDir(), 2, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	b := New()
+	b.SetJournal(j)
+	b.Publish("a", EventStateChange, nil)
+
+	r, err := j.Since(0, Filter{Sources: []string{"a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if got := readAll(r); !slices.Equal(got, []uint64{1}) {
+		t.Fatalf("read %v, want [1]", got)
+	}
+
+	// Later events are picked up, across a new segment, and filtered
+	b.Publish("b", EventStateChange, nil)
+	b.Publish("a", EventStateChange, nil)
+	b.Publish("a", EventStateChange, nil)
+	if got := readAll(r); !slices.Equal(got, []uint64{3, 4}) {
+		t.Errorf("read %v, want [3 4]", got)
+	}
+}
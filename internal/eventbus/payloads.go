@@ -0,0 +1,64 @@
+package eventbus
+
+// Payloads of the session lifecycle events. Each is published as the event's
+// data, with the session ID as its source (except where noted).
+
+// SessionCreated is the data of EventSessionCreated
+type SessionCreated struct {
+	Backend string `json:"backend"`
+	Cwd     string `json:"cwd"`
+	Sandbox string `json:"sandbox,omitempty"` // empty for the default sandbox
+	Model   string `json:"model,omitempty"`   // empty for the backend default
+}
+
+// SessionKilled is the data of EventSessionKilled
+type SessionKilled struct {
+	Backend string `json:"backend"`
+	Alias   string `json:"alias,omitempty"`
+}
+
+// SessionRecovered is the data of EventSessionRecovered, published for each
+// tmux window adopted at startup or by the "recover" ctl command
+type SessionRecovered struct {
+	Backend string `json:"backend"`
+	Cwd     string `json:"cwd"`
+	Alias   string `json:"alias,omitempty"`
+	Role    string `json:"role,omitempty"`
+}
+
+// AliasChanged is the data of EventAliasChanged
+type AliasChanged struct {
+	OldAlias string `json:"old_alias"`
+	NewAlias string `json:"new_alias"`
+}
+
+// RoleChanged is the data of EventRoleChanged
+type RoleChanged struct {
+	OldRole string `json:"old_role"`
+	NewRole string `json:"new_role"`
+}
+
+// ContextChanged is the data of EventContextChanged. The context is sent
+// with the session's next prompt.
+type ContextChanged struct {
+	Context string `json:"context"`
+}
+
+// CrashRestart is the data of EventCrashRestart. Restarted is false when
+// the restart was skipped (the last attempt was too recent) or failed, with
+// Error saying why.
+type CrashRestart struct {
+	CrashCount int    `json:"crash_count"`
+	Restarted  bool   `json:"restarted"`
+	Error      string `json:"error,omitempty"`
+}
+
+// SandboxLoadFailed is the data of EventSandboxLoadFailed. Its source is
+// the session when a restart failed, or "backend/<name>" when a new session
+// could not be created.
+type SandboxLoadFailed struct {
+	Backend string `json:"backend"`
+	Layer   string `json:"layer"` // "global", "backend" or "sandbox"
+	Name    string `json:"name"`  // file that failed: global, the backend or the sandbox name
+	Error   string `json:"error"`
+}
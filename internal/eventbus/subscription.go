@@ -0,0 +1,352 @@
+package eventbus
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	ps "github.com/simonfxr/pubsub"
+)
+
+// DefaultBuffer is the number of events a subscription queues when
+// SubscribeOptions.Buffer is not set
+const DefaultBuffer = 64
+
+// MaxBuffer caps SubscribeOptions.Buffer
+const MaxBuffer = 65536
+
+// BlockTimeout is how long a blocking subscription waits for its consumer
+// to make room before dropping an event
+const BlockTimeout = 5 * time.Second
+
+// SubscribeOptions configures a subscription
+type SubscribeOptions struct {
+	Name   string // shown in Stats, e.g. "maildir" or "events"
+	Filter Filter
+	Buffer int  // queued events; 0 means DefaultBuffer
+	Block  bool // wait for the consumer (up to BlockTimeout) instead of dropping events
+}
+
+// Subscription delivers the events that pass its filter to C. When C is
+// full, events are dropped and counted; once there is room again, an
+// EventsDropped event carrying the count is queued before the next event,
+// so the consumer knows its stream has a gap. Blocking subscriptions queue
+// up to Buffer more events, which their own goroutine feeds to C as the
+// consumer makes room; Publish never waits for them. The wait is bounded
+// by BlockTimeout: a consumer that stops reading has its queue dropped, and
+// further events are dropped without waiting until it has room for the
+// EventsDropped event.
+type Subscription struct {
+	C <-chan *Event
+
+	bus    *Bus
+	sub    *ps.Subscription
+	id     uint64
+	name   string
+	buffer int
+	block  bool
+	mu     sync.Mutex
+	ch     chan *Event
+	filter Filter
+	closed bool
+
+	// Blocking subscriptions only
+	queue   []*Event      // events waiting for room in C; nil marks dropped ones
+	wake    *sync.Cond    // on mu; signalled when queue or missed grow, and on Cancel
+	done    chan struct{} // closed on Cancel, ends the pump's wait
+	pumped  chan struct{} // closed once the pump has closed C
+	stalled bool          // a send timed out and C has not had room since
+
+	delivered uint64
+	dropped   uint64
+	missed    uint64 // dropped events not yet reported with EventsDropped
+}
+
+// SubscriberStats is a snapshot of a subscription's counters
+type SubscriberStats struct {
+	ID        uint64 `json:"id"`
+	Name      string `json:"name"`
+	Filter    string `json:"filter"`
+	Buffer    int    `json:"buffer"`
+	Block     bool   `json:"block"`
+	Queued    int    `json:"queued"`
+	Delivered uint64 `json:"delivered"`
+	Dropped   uint64 `json:"dropped"`
+}
+
+// Subscribe returns a read channel that receives *Event values and a cancel
+// function. The channel has a buffer of 64 events; events are dropped when
+// the buffer is full (slow consumer). Calling cancel removes the subscription
+// and closes the channel.
+func (b *Bus) Subscribe() (<-chan *Event, func()) {
+	sub := b.SubscribeWith(SubscribeOptions{})
+	return sub.C, sub.Cancel
+}
+
+// SubscribeFilter subscribes to the events that pass f. Only matching
+// events are enqueued, so the 64-event buffer is not taken up by events the
+// consumer would discard; as with Subscribe, events are dropped when it is
+// full.
+func (b *Bus) SubscribeFilter(f Filter) *Subscription {
+	return b.SubscribeWith(SubscribeOptions{Filter: f})
+}
+
+// SubscribeWith subscribes with the given options
+func (b *Bus) SubscribeWith(o SubscribeOptions) *Subscription {
+	buffer := o.Buffer
+	if buffer <= 0 {
+		buffer = DefaultBuffer
+	}
+	buffer = min(buffer, MaxBuffer)
+	ch := make(chan *Event, buffer)
+	s := &Subscription{
+		C:      ch,
+		bus:    b,
+		name:   o.Name,
+		buffer: buffer,
+		block:  o.Block,
+		ch:     ch,
+		filter: o.Filter,
+		done:   make(chan struct{}),
+		pumped: make(chan struct{}),
+	}
+	s.wake = sync.NewCond(&s.mu)
+	if s.block {
+		go s.pump()
+	}
+
+	b.subsMu.Lock()
+	b.lastSub++
+	s.id = b.lastSub
+	b.subs = append(b.subs, s)
+	b.subsMu.Unlock()
+
+	s.sub = b.bus.Subscribe(allTopic, s.deliver)
+	return s
+}
+
+// Stats returns the counters of all current subscriptions, oldest first
+func (b *Bus) Stats() []SubscriberStats {
+	b.subsMu.Lock()
+	subs := append([]*Subscription(nil), b.subs...)
+	b.subsMu.Unlock()
+
+	stats := make([]SubscriberStats, 0, len(subs))
+	for _, s := range subs {
+		stats = append(stats, s.Stats())
+	}
+	return stats
+}
+
+// deliver runs in the publishing goroutine and never blocks: blocking
+// subscriptions hand the event to their pump.
+func (s *Subscription) deliver(e *Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	if s.block {
+		switch {
+		case !s.filter.Match(e.Type, e.Source):
+		case s.stalled || len(s.queue) >= s.buffer:
+			s.dropped++
+			s.missed++
+			if n := len(s.queue); n == 0 || s.queue[n-1] != nil {
+				s.queue = append(s.queue, nil) // report the drops here
+				s.wake.Signal()
+			}
+		default:
+			s.queue = append(s.queue, e)
+			s.wake.Signal()
+		}
+		return
+	}
+
+	// Any published event is a chance to report drops, matching or not
+	s.reportDropped()
+	if !s.filter.Match(e.Type, e.Source) {
+		return
+	}
+	select {
+	case s.ch <- e:
+		s.delivered++
+	default:
+		s.dropped++
+		s.missed++
+	}
+}
+
+// pump feeds a blocking subscription's queue to C, in its own goroutine so
+// that waiting for the consumer holds up nothing else. A nil entry in the
+// queue marks where events were dropped; an EventsDropped event is sent in
+// its place. It closes C once the subscription is cancelled.
+func (s *Subscription) pump() {
+	defer close(s.pumped)
+	defer close(s.ch)
+	for {
+		s.mu.Lock()
+		for !s.closed && len(s.queue) == 0 {
+			s.wake.Wait()
+		}
+		if s.closed {
+			s.mu.Unlock()
+			return
+		}
+		e := s.queue[0]
+		var report uint64
+		if e == nil {
+			if s.missed == 0 {
+				// Already reported at an earlier mark
+				s.queue = s.queue[1:]
+				s.mu.Unlock()
+				continue
+			}
+			report = s.missed
+			e = droppedEvent(report)
+		}
+		// A stalled consumer gets no timeout: nothing is queued meanwhile
+		timed := !s.stalled
+		s.mu.Unlock()
+
+		sent := s.send(e, timed)
+
+		s.mu.Lock()
+		switch {
+		case sent:
+			s.queue = s.queue[1:]
+			if report > 0 {
+				s.missed -= report
+				s.stalled = false
+			} else {
+				s.delivered++
+			}
+		case report == 0:
+			// Timed out: drop the event and everything queued behind it
+			n := uint64(s.queuedLocked())
+			s.queue = []*Event{nil}
+			s.dropped += n
+			s.missed += n
+			s.stalled = true
+		}
+		s.mu.Unlock()
+	}
+}
+
+// queuedLocked counts the events waiting in the queue, without drop marks.
+// Caller must hold s.mu.
+func (s *Subscription) queuedLocked() int {
+	n := 0
+	for _, e := range s.queue {
+		if e != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// send hands e to the consumer, waiting up to BlockTimeout if timed, and
+// reports whether it was sent. Cancel ends the wait.
+func (s *Subscription) send(e *Event, timed bool) bool {
+	var timeout <-chan time.Time
+	if timed {
+		t := time.NewTimer(BlockTimeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+	select {
+	case s.ch <- e:
+		return true
+	case <-timeout:
+		return false
+	case <-s.done:
+		return false
+	}
+}
+
+// reportDropped queues an EventsDropped event if events were dropped since
+// the last one and there is room for it. Caller must hold s.mu.
+func (s *Subscription) reportDropped() {
+	if s.missed == 0 {
+		return
+	}
+	select {
+	case s.ch <- droppedEvent(s.missed):
+		s.missed = 0
+	default:
+	}
+}
+
+// droppedEvent builds the EventsDropped event reporting count drops
+func droppedEvent(count uint64) *Event {
+	return &Event{
+		ID:     uuid.New().String(),
+		TS:     time.Now().Unix(),
+		Source: "eventbus",
+		Type:   EventEventsDropped,
+		Data:   map[string]any{"count": count},
+	}
+}
+
+// SetFilter replaces the subscription's filter; events already enqueued
+// are kept
+func (s *Subscription) SetFilter(f Filter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.filter = f
+}
+
+// Options returns the options the subscription was created with, with its
+// current filter
+func (s *Subscription) Options() SubscribeOptions {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return SubscribeOptions{Name: s.name, Filter: s.filter, Buffer: s.buffer, Block: s.block}
+}
+
+// Stats returns a snapshot of the subscription's counters
+func (s *Subscription) Stats() SubscriberStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return SubscriberStats{
+		ID:        s.id,
+		Name:      s.name,
+		Filter:    s.filter.String(),
+		Buffer:    s.buffer,
+		Block:     s.block,
+		Queued:    len(s.ch) + s.queuedLocked(),
+		Delivered: s.delivered,
+		Dropped:   s.dropped,
+	}
+}
+
+// Cancel removes the subscription and closes C. Events still queued for a
+// blocking subscription are discarded.
+func (s *Subscription) Cancel() {
+	s.bus.bus.Unsubscribe(s.sub)
+
+	s.bus.subsMu.Lock()
+	for i, sub := range s.bus.subs {
+		if sub == s {
+			s.bus.subs = append(s.bus.subs[:i], s.bus.subs[i+1:]...)
+			break
+		}
+	}
+	s.bus.subsMu.Unlock()
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	close(s.done)
+	s.wake.Broadcast()
+	s.mu.Unlock()
+
+	if s.block {
+		<-s.pumped
+	} else {
+		close(s.ch)
+	}
+}
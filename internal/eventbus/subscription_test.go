@@ -0,0 +1,97 @@
+package eventbus
+
+import (
+	"testing"
+	"time"
+)
+
+// next reads one event or fails the test
+func next(t *testing.T, ch <-chan *Event) *Event {
+	t.Helper()
+	select {
+	case e, ok := <-ch:
+		if !ok {
+			t.Fatal("channel closed")
+		}
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("no event")
+	}
+	return nil
+}
+
+func TestBlockingSubscriberHoldsUpOnlyItself(t *testing.T) {
+	b := New()
+	stuck := b.SubscribeWith(SubscribeOptions{Name: "stuck", Buffer: 1, Block: true})
+	defer stuck.Cancel()
+	other := b.SubscribeWith(SubscribeOptions{Name: "other", Buffer: 100})
+	defer other.Cancel()
+
+	// Wait for the first event to reach C, so the second is the one the
+	// pump waits with
+	b.Publish("a", EventStateChange, 0)
+	for deadline := time.Now().Add(time.Second); stuck.Stats().Delivered == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("first event not delivered")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	start := time.Now()
+	for i := 1; i < 10; i++ {
+		b.Publish("a", EventStateChange, i)
+	}
+	if took := time.Since(start); took > BlockTimeout/2 {
+		t.Fatalf("Publish waited %v for a blocking subscriber", took)
+	}
+	for want := uint64(1); want <= 10; want++ {
+		if e := next(t, other.C); e.Seq != want {
+			t.Fatalf("other got seq %d, want %d", e.Seq, want)
+		}
+	}
+
+	// One event in C, one queued behind it, the rest dropped
+	st := stuck.Stats()
+	if st.Queued != 2 || st.Dropped != 8 || st.Delivered != 1 {
+		t.Errorf("stats %+v", st)
+	}
+	for _, want := range []uint64{1, 2} {
+		if e := next(t, stuck.C); e.Seq != want {
+			t.Fatalf("got seq %d, want %d", e.Seq, want)
+		}
+	}
+	e := next(t, stuck.C)
+	if e.Type != EventEventsDropped || e.Data.(map[string]any)["count"] != uint64(8) {
+		t.Errorf("got %s %v, want EventsDropped with count 8", e.Type, e.Data)
+	}
+
+	b.Publish("a", EventStateChange, nil)
+	if e := next(t, stuck.C); e.Seq != 11 {
+		t.Errorf("after the report got seq %d, want 11", e.Seq)
+	}
+}
+
+func TestCancelBlockingSubscriber(t *testing.T) {
+	b := New()
+	s := b.SubscribeWith(SubscribeOptions{Buffer: 1, Block: true})
+	for i := 0; i < 3; i++ {
+		b.Publish("a", EventStateChange, i)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.Cancel()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Cancel waited for the consumer")
+	}
+	for range s.C {
+	}
+	b.Publish("a", EventStateChange, nil) // no subscriber left to deliver to
+	if n := len(b.Stats()); n != 0 {
+		t.Errorf("%d subscriptions left", n)
+	}
+}
@@ -0,0 +1,359 @@
+package mailbox
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Attachment is a file sent along with a message. When a message is
+// written, Content carries the data (text, or base64 when Encoding is
+// "base64"), or is omitted to attach the file of that name the sender
+// staged as a draft (see StageAttachment). StoreAttachments moves the data
+// into the content-addressed attachment store and the message keeps only
+// the reference. Recipients read attachments lazily through the 9P tree.
+type Attachment struct {
+	Name     string `json:"name"`
+	Size     int64  `json:"size"`
+	SHA256   string `json:"sha256"`
+	Encoding string `json:"encoding,omitempty"` // "base64" for binary content on write
+	Content  string `json:"content,omitempty"`  // inline data on write; never stored
+}
+
+// AttachmentLimits caps the attachments of a message (and a participant's
+// drafts); zero fields are unlimited
+type AttachmentLimits struct {
+	MaxSize  int64 // bytes per attachment
+	MaxCount int   // attachments per message
+	MaxTotal int64 // bytes per message, all attachments together
+}
+
+var validSHA256 = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// SetAttachmentDir sets where attachment contents are stored (one file per
+// SHA-256 digest). Until it is set, messages with attachments are rejected.
+func (m *Manager) SetAttachmentDir(dir string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.attachmentDir = dir
+}
+
+func validateAttachmentName(name string) error {
+	if name == "" || name != filepath.Base(name) || name == "." || name == ".." {
+		return fmt.Errorf("invalid attachment name %q", name)
+	}
+	return nil
+}
+
+// StoreAttachments writes the inline content of a message's attachments to
+// the attachment store and replaces it with a reference (digest and size).
+// An attachment without content takes the sender's draft of the same name,
+// which is then used up. Client-supplied digests and sizes are ignored and
+// recomputed from the content, so a message can only reference data its
+// sender provided.
+func (m *Manager) StoreAttachments(msg *Message, limits AttachmentLimits) error {
+	if len(msg.Attachments) == 0 {
+		return nil
+	}
+	if limits.MaxCount > 0 && len(msg.Attachments) > limits.MaxCount {
+		return fmt.Errorf("message has %d attachments, more than the limit of %d", len(msg.Attachments), limits.MaxCount)
+	}
+
+	// Blobs are written and touched under the read lock: CollectAttachments
+	// takes the write lock, so it finds each one either absent or fresh
+	m.mu.RLock()
+	drafted, err := m.storeAttachmentsLocked(msg, limits)
+	m.mu.RUnlock()
+	if err != nil || len(drafted) == 0 {
+		return err
+	}
+
+	// The drafts are used up by the message
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, name := range drafted {
+		delete(m.drafts[msg.From], name)
+	}
+	return nil
+}
+
+// storeAttachmentsLocked does the work of StoreAttachments and returns the
+// names of the drafts used. Caller must hold m.mu (read lock suffices).
+func (m *Manager) storeAttachmentsLocked(msg *Message, limits AttachmentLimits) ([]string, error) {
+	dir := m.attachmentDir
+	if dir == "" {
+		return nil, fmt.Errorf("attachments not available")
+	}
+
+	seen := make(map[string]bool)
+	var total int64
+	var drafted []string
+	for i := range msg.Attachments {
+		a := &msg.Attachments[i]
+		if err := validateAttachmentName(a.Name); err != nil {
+			return nil, err
+		}
+		if seen[a.Name] {
+			return nil, fmt.Errorf("duplicate attachment name %q", a.Name)
+		}
+		seen[a.Name] = true
+
+		if a.Content == "" && a.Encoding == "" {
+			draft, ok := m.drafts[msg.From][a.Name]
+			if !ok {
+				return nil, fmt.Errorf("attachment %s has no content and no draft of that name", a.Name)
+			}
+			if total += draft.Size; limits.MaxTotal > 0 && total > limits.MaxTotal {
+				return nil, fmt.Errorf("attachments total more than the %d byte limit", limits.MaxTotal)
+			}
+			a.SHA256, a.Size = draft.SHA256, draft.Size
+			drafted = append(drafted, a.Name)
+			continue
+		}
+
+		data := []byte(a.Content)
+		switch a.Encoding {
+		case "":
+		case "base64":
+			decoded, err := base64.StdEncoding.DecodeString(a.Content)
+			if err != nil {
+				return nil, fmt.Errorf("attachment %s: invalid base64: %v", a.Name, err)
+			}
+			data = decoded
+		default:
+			return nil, fmt.Errorf("attachment %s: unknown encoding %q (use base64 or omit)", a.Name, a.Encoding)
+		}
+		if limits.MaxSize > 0 && int64(len(data)) > limits.MaxSize {
+			return nil, fmt.Errorf("attachment %s is %d bytes, larger than the %d byte limit", a.Name, len(data), limits.MaxSize)
+		}
+		if total += int64(len(data)); limits.MaxTotal > 0 && total > limits.MaxTotal {
+			return nil, fmt.Errorf("attachments total more than the %d byte limit", limits.MaxTotal)
+		}
+
+		sum := sha256.Sum256(data)
+		digest := hex.EncodeToString(sum[:])
+		if err := writeBlob(dir, digest, data); err != nil {
+			return nil, fmt.Errorf("attachment %s: %w", a.Name, err)
+		}
+		a.SHA256, a.Size = digest, int64(len(data))
+		a.Encoding, a.Content = "", ""
+	}
+	return drafted, nil
+}
+
+// StageAttachment stores data as a participant's draft attachment, replacing
+// any draft of the same name. A message the participant sends next can
+// attach it by name without inline content. Drafts are kept in memory only.
+func (m *Manager) StageAttachment(participant, name string, data []byte, limits AttachmentLimits) error {
+	if err := validateAttachmentName(name); err != nil {
+		return err
+	}
+	if limits.MaxSize > 0 && int64(len(data)) > limits.MaxSize {
+		return fmt.Errorf("attachment %s is %d bytes, larger than the %d byte limit", name, len(data), limits.MaxSize)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.attachmentDir == "" {
+		return fmt.Errorf("attachments not available")
+	}
+
+	count, total := 1, int64(len(data))
+	for other, a := range m.drafts[participant] {
+		if other != name {
+			count++
+			total += a.Size
+		}
+	}
+	if limits.MaxCount > 0 && count > limits.MaxCount {
+		return fmt.Errorf("more than %d draft attachments", limits.MaxCount)
+	}
+	if limits.MaxTotal > 0 && total > limits.MaxTotal {
+		return fmt.Errorf("draft attachments total more than the %d byte limit", limits.MaxTotal)
+	}
+
+	sum := sha256.Sum256(data)
+	digest := hex.EncodeToString(sum[:])
+	if err := writeBlob(m.attachmentDir, digest, data); err != nil {
+		return fmt.Errorf("attachment %s: %w", name, err)
+	}
+	if m.drafts[participant] == nil {
+		m.drafts[participant] = make(map[string]Attachment)
+	}
+	m.drafts[participant][name] = Attachment{Name: name, Size: int64(len(data)), SHA256: digest}
+	return nil
+}
+
+// Drafts returns a participant's draft attachments, ordered by name
+func (m *Manager) Drafts(participant string) []Attachment {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make([]Attachment, 0, len(m.drafts[participant]))
+	for _, a := range m.drafts[participant] {
+		result = append(result, a)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// DiscardDraft removes a participant's draft attachment
+func (m *Manager) DiscardDraft(participant, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.drafts[participant][name]; !ok {
+		return fmt.Errorf("draft not found")
+	}
+	delete(m.drafts[participant], name)
+	if len(m.drafts[participant]) == 0 {
+		delete(m.drafts, participant)
+	}
+	return nil
+}
+
+// OpenDraft opens a participant's draft attachment. The caller must close
+// the file.
+func (m *Manager) OpenDraft(participant, name string) (*os.File, error) {
+	m.mu.RLock()
+	a, ok := m.drafts[participant][name]
+	dir := m.attachmentDir
+	m.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("draft not found")
+	}
+	return os.Open(filepath.Join(dir, a.SHA256))
+}
+
+// writeBlob stores data under its digest, unless it is already there. An
+// existing blob is touched, so CollectAttachments sees it as recently used.
+func writeBlob(dir, digest string, data []byte) error {
+	path := filepath.Join(dir, digest)
+	if _, err := os.Stat(path); err == nil {
+		now := time.Now()
+		return os.Chtimes(path, now, now)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, digest+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// CollectAttachments deletes stored attachment contents that no message in
+// any folder and no draft refers to any more, e.g. after their messages were
+// purged. Files written or reused within grace are kept: the message that
+// refers to them may not have reached a folder yet. Returns the number of
+// files deleted.
+func (m *Manager) CollectAttachments(grace time.Duration) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.attachmentDir == "" {
+		return 0, nil
+	}
+	entries, err := os.ReadDir(m.attachmentDir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	referenced := make(map[string]bool)
+	for _, folder := range []map[string][]*Message{m.inboxes, m.outboxes, m.completed, m.deadletter} {
+		for _, msgs := range folder {
+			for _, msg := range msgs {
+				for _, a := range msg.Attachments {
+					referenced[a.SHA256] = true
+				}
+			}
+		}
+	}
+	for _, drafts := range m.drafts {
+		for _, a := range drafts {
+			referenced[a.SHA256] = true
+		}
+	}
+
+	cutoff := time.Now().Add(-grace)
+	removed := 0
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || referenced[name] {
+			continue
+		}
+		// Blobs, and temp files left by an interrupted write
+		if !validSHA256.MatchString(name) && !strings.HasSuffix(name, ".tmp") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(m.attachmentDir, name)); err == nil {
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// MessagesWithAttachments returns the messages in any of a participant's
+// folders that carry attachments, ordered by ID
+func (m *Manager) MessagesWithAttachments(participant string) []*Message {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var result []*Message
+	for _, folder := range [][]*Message{m.inboxes[participant], m.outboxes[participant],
+		m.completed[participant], m.deadletter[participant]} {
+		for _, msg := range folder {
+			if len(msg.Attachments) > 0 {
+				result = append(result, msg)
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// OpenAttachment opens a named attachment of a message in one of a
+// participant's folders. The caller must close the file.
+func (m *Manager) OpenAttachment(participant, msgID, name string) (*os.File, error) {
+	msg, err := m.GetMessage(participant, msgID)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	dir := m.attachmentDir
+	m.mu.RUnlock()
+
+	for _, a := range msg.Attachments {
+		if a.Name == name {
+			if dir == "" || !validSHA256.MatchString(a.SHA256) {
+				return nil, fmt.Errorf("attachment not available")
+			}
+			return os.Open(filepath.Join(dir, a.SHA256))
+		}
+	}
+	return nil, fmt.Errorf("attachment not found")
+}
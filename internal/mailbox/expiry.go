@@ -0,0 +1,94 @@
+package mailbox
+
+import "time"
+
+// ReasonExpired is recorded in metadata.reason (and metadata.error for
+// dead letters) when a message passes its expires_at time.
+const ReasonExpired = "expired"
+
+// Expired describes a message removed by ExpireMessages
+type Expired struct {
+	Participant string // mailbox the message was expired from
+	Folder      string // "inbox" (never completed) or "outbox" (never delivered)
+	Message     *Message
+}
+
+// applyTTL derives expires_at from ttl when only the latter is given
+func applyTTL(msg *Message) {
+	if msg.ExpiresAt == 0 && msg.TTL > 0 {
+		ts := msg.Timestamp
+		if ts == 0 {
+			ts = time.Now().Unix()
+		}
+		msg.ExpiresAt = ts + msg.TTL
+	}
+}
+
+// expired reports whether a message has an expiry time at or before now
+func (msg *Message) expired(now int64) bool {
+	return msg.ExpiresAt > 0 && msg.ExpiresAt <= now
+}
+
+// ExpireMessages removes every message past its expiry time. Inbox
+// messages, read or not, move to the recipient's completed folder and count
+// as done (the done callback fires). Messages still waiting in an outbox
+// move to the sender's dead-letter folder. Both are marked with reason
+// "expired".
+func (m *Manager) ExpireMessages(now time.Time) []Expired {
+	m.mu.Lock()
+	defer m.unlock()
+
+	var result []Expired
+	for id := range m.inboxes {
+		changed := false
+
+		var keep []*Message
+		for _, msg := range m.inboxes[id] {
+			if !msg.expired(now.Unix()) {
+				keep = append(keep, msg)
+				continue
+			}
+			markExpired(msg, false)
+			msg.CompletedAt = now.Unix()
+			m.completed[id] = append(m.completed[id], msg)
+			result = append(result, Expired{Participant: id, Folder: "inbox", Message: msg})
+			changed = true
+		}
+		m.inboxes[id] = nonNil(keep)
+
+		keep = nil
+		for _, msg := range m.outboxes[id] {
+			if !msg.expired(now.Unix()) {
+				keep = append(keep, msg)
+				continue
+			}
+			markExpired(msg, true)
+			m.deadletter[id] = append(m.deadletter[id], msg)
+			result = append(result, Expired{Participant: id, Folder: "outbox", Message: msg})
+			changed = true
+		}
+		m.outboxes[id] = nonNil(keep)
+
+		if changed {
+			m.persist(id)
+		}
+	}
+
+	for _, e := range result {
+		if e.Folder == "inbox" {
+			m.doneLocked(e.Participant, e.Message)
+		}
+	}
+	return result
+}
+
+func markExpired(msg *Message, deadLetter bool) {
+	if msg.Metadata == nil {
+		msg.Metadata = make(map[string]interface{})
+	}
+	msg.Metadata["reason"] = ReasonExpired
+	if deadLetter {
+		msg.Metadata["error"] = ReasonExpired
+		msg.NextAttempt = 0
+	}
+}
@@ -0,0 +1,83 @@
+package mailbox
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpireMessages(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Minute).Unix(), now.Add(time.Hour).Unix()
+
+	tests := []struct {
+		name      string
+		expiresAt int64
+		read      bool
+		expired   bool // moved out of the inbox
+	}{
+		{name: "unread and expired", expiresAt: past, expired: true},
+		{name: "read but not completed, expired", expiresAt: past, read: true, expired: true},
+		{name: "read, not yet expired", expiresAt: future, read: true},
+		{name: "no expiry", read: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewManager()
+			m.EnsureMailbox("a")
+			msg := NewMessage("user", "a", MessageTypePromptRequest, "s", "b")
+			msg.ExpiresAt = tt.expiresAt
+			if err := m.DeliverToInbox("a", msg); err != nil {
+				t.Fatal(err)
+			}
+			if tt.read {
+				if err := m.MarkRead("a", msg.ID); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if got := m.HasNudgeMessages("a"); got == tt.expired {
+				t.Errorf("HasNudgeMessages = %v before expiry ran", got)
+			}
+
+			result := m.ExpireMessages(now)
+			if got := len(result) == 1; got != tt.expired {
+				t.Fatalf("expired %d messages", len(result))
+			}
+			inInbox := len(m.GetInbox("a")) == 1
+			if inInbox == tt.expired {
+				t.Errorf("message in inbox: %v", inInbox)
+			}
+			if !tt.expired {
+				return
+			}
+			if e := result[0]; e.Folder != "inbox" || e.Participant != "a" || e.Message.ID != msg.ID {
+				t.Errorf("got %+v", e)
+			}
+			completed := m.GetCompleted("a")
+			if len(completed) != 1 || completed[0].CompletedAt != now.Unix() || completed[0].Metadata["reason"] != ReasonExpired {
+				t.Errorf("completed folder %+v", completed)
+			}
+		})
+	}
+}
+
+func TestExpireLeavesCompleted(t *testing.T) {
+	m := NewManager()
+	m.EnsureMailbox("a")
+	msg := NewMessage("user", "a", MessageTypePromptRequest, "s", "b")
+	msg.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+	m.DeliverToInbox("a", msg)
+	if err := m.CompleteMessage("a", msg.ID); err != nil {
+		t.Fatal(err)
+	}
+	completedAt := m.GetCompleted("a")[0].CompletedAt
+
+	if result := m.ExpireMessages(time.Now().Add(time.Hour)); len(result) != 0 {
+		t.Errorf("expired %d completed messages", len(result))
+	}
+	completed := m.GetCompleted("a")
+	if len(completed) != 1 || completed[0].CompletedAt != completedAt || completed[0].Metadata["reason"] != nil {
+		t.Errorf("completed folder changed: %+v", completed)
+	}
+}
@@ -1,40 +1,93 @@
 package mailbox
 
 import (
+	"anvillm/pkg/logging"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
+
+	"go.uber.org/zap"
 )
 
+// ErrDuplicateMessage is returned by DeliverToInbox when the receiver already
+// holds a message with the same ID (e.g. a delivery retried after a crash).
+var ErrDuplicateMessage = errors.New("duplicate message id")
+
+// Archive durably records deliveries and completions, unlike the event
+// callbacks, whose consumers may drop events. Like the callbacks, it is
+// called after the mailbox lock is released, in operation order. The
+// maildir archive implements it and is replayed on startup.
+type Archive interface {
+	Received(participant string, msg *Message)
+	Done(participant string, msg *Message) // completed, pulled, deleted or expired
+}
+
 // SessionGetter provides access to session aliases
 type SessionGetter interface {
 	GetAlias(id string) string
 }
 
-// Manager handles mailbox operations for all sessions (in-memory)
+// Manager handles mailbox operations for all sessions.
+// Folders live in memory and are mirrored to an optional Store.
 type Manager struct {
 	// sessionID -> list of messages
 	inboxes   map[string][]*Message
 	outboxes  map[string][]*Message
 	completed map[string][]*Message
+	// Messages that could not be delivered, kept in the sender's mailbox
+	deadletter map[string][]*Message
+	// topic -> set of subscribed participants
+	topics map[string]map[string]bool
+
+	// Thread index over delivered messages (inbox and completed folders):
+	// threadID -> messages in delivery order, messageID -> its thread and
+	// receiver, participant -> threadID -> number of its messages there
+	threads            map[string][]*Message
+	threadOf           map[string]threadEntry
+	participantThreads map[string]map[string]int
+
 	mu        sync.RWMutex
 	idCounter uint64
 	sessions  SessionGetter
+	store     *Store
+	archive   Archive
+	pending   []func()        // callbacks and store writes queued under mu, run by unlock
+	dirty     map[string]bool // participants changed since their last write
+	notifying sync.Mutex // held while running callbacks, to keep their order
 	onSend    func(senderID string, msg *Message)
 	onRecv    func(receiverID string, msg *Message)
+	onQueue   func(senderID string, msg *Message)
+	onRead    func(participant string, msg *Message)
+	onDone    func(participant string, msg *Message)
+	onReply   func(request, response *Message)
+	onDelete  func(participant string, msg *Message)
+
+	attachmentDir string                           // content-addressed attachment store
+	drafts        map[string]map[string]Attachment // participant -> staged attachments by name
 }
 
 // NewManager creates a new mailbox manager
 func NewManager() *Manager {
 	m := &Manager{
-		inboxes:   make(map[string][]*Message),
-		outboxes:  make(map[string][]*Message),
-		completed: make(map[string][]*Message),
+		inboxes:            make(map[string][]*Message),
+		outboxes:           make(map[string][]*Message),
+		completed:          make(map[string][]*Message),
+		deadletter:         make(map[string][]*Message),
+		topics:             make(map[string]map[string]bool),
+		threads:            make(map[string][]*Message),
+		threadOf:           make(map[string]threadEntry),
+		participantThreads: make(map[string]map[string]int),
+		drafts:             make(map[string]map[string]Attachment),
+		dirty:              make(map[string]bool),
 	}
 	// Initialize user mailbox
 	m.inboxes["user"] = []*Message{}
 	m.outboxes["user"] = []*Message{}
 	m.completed["user"] = []*Message{}
+	m.deadletter["user"] = []*Message{}
 	return m
 }
 
@@ -45,7 +98,131 @@ func (m *Manager) SetSessionGetter(sg SessionGetter) {
 	m.sessions = sg
 }
 
-// SetEventCallbacks sets callbacks for send/receive events
+// SetStore attaches a persistent store and rehydrates all mailboxes from it.
+// Persisted folders replace any (empty) in-memory folders created before the
+// store was attached. Every subsequent mutation is written to disk once the
+// mailbox lock is released.
+func (m *Manager) SetStore(st *Store) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.store = st
+	loaded, err := st.Load()
+	for id, f := range loaded {
+		m.inboxes[id] = sortInbox(nonNil(f.Inbox))
+		m.outboxes[id] = nonNil(f.Outbox)
+		m.completed[id] = nonNil(f.Completed)
+		m.deadletter[id] = nonNil(f.DeadLetter)
+		for _, topic := range f.Topics {
+			if m.topics[topic] == nil {
+				m.topics[topic] = make(map[string]bool)
+			}
+			m.topics[topic][id] = true
+		}
+		logging.Logger().Info("restored mailbox", zap.String("participant", id),
+			zap.Int("inbox", len(f.Inbox)), zap.Int("outbox", len(f.Outbox)))
+	}
+	m.rebuildThreadsLocked()
+	return err
+}
+
+// Restore puts messages that a participant received but never completed
+// back into its inbox, e.g. when replaying the maildir archive on startup.
+// Messages already in its inbox or completed folder are skipped, as are
+// participants without a mailbox. No callbacks are invoked: the messages
+// were delivered before. Returns the number of messages restored.
+func (m *Manager) Restore(participant string, msgs []*Message) int {
+	m.mu.Lock()
+	defer m.unlock()
+
+	if _, ok := m.inboxes[participant]; !ok {
+		return 0
+	}
+	have := make(map[string]bool)
+	for _, folder := range [][]*Message{m.inboxes[participant], m.completed[participant]} {
+		for _, msg := range folder {
+			have[msg.ID] = true
+		}
+	}
+
+	restored := 0
+	for _, msg := range msgs {
+		if have[msg.ID] {
+			continue
+		}
+		have[msg.ID] = true
+		m.indexThreadLocked(participant, msg)
+		m.inboxes[participant] = insertOrdered(m.inboxes[participant], msg)
+		restored++
+	}
+	if restored > 0 {
+		m.persist(participant)
+	}
+	return restored
+}
+
+// persist schedules a write of participants' folders to the store. Writes
+// are queued with the callbacks and run by unlock, outside m.mu and in
+// order; changes made before a queued write runs are saved by that write.
+// Caller must hold m.mu and release it with unlock. Failures are logged,
+// not returned: the in-memory state remains authoritative and the next
+// mutation retries the write.
+func (m *Manager) persist(ids ...string) {
+	if m.store == nil {
+		return
+	}
+	for _, id := range ids {
+		if _, ok := m.inboxes[id]; !ok || m.dirty[id] {
+			continue
+		}
+		m.dirty[id] = true
+		m.pending = append(m.pending, func() { m.save(id) })
+	}
+}
+
+// save writes a participant's folders if they changed since the last write.
+// Called only by unlock, so writes never overtake each other.
+func (m *Manager) save(id string) {
+	m.mu.Lock()
+	if !m.dirty[id] {
+		m.mu.Unlock()
+		return
+	}
+	delete(m.dirty, id)
+	st := m.store
+	data, err := json.Marshal(&folders{
+		Inbox:      m.inboxes[id],
+		Outbox:     m.outboxes[id],
+		Completed:  m.completed[id],
+		DeadLetter: m.deadletter[id],
+		Topics:     m.subscriptionsLocked(id),
+	})
+	m.mu.Unlock()
+
+	if err == nil {
+		err = st.write(id, data)
+	}
+	if err != nil {
+		logging.Logger().Warn("failed to persist mailbox", zap.String("participant", id), zap.Error(err))
+	}
+}
+
+func nonNil(msgs []*Message) []*Message {
+	if msgs == nil {
+		return []*Message{}
+	}
+	return msgs
+}
+
+// SetArchive sets where deliveries and completions are recorded
+func (m *Manager) SetArchive(a Archive) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.archive = a
+}
+
+// SetEventCallbacks sets callbacks for send/receive events. Callbacks get a
+// copy of the message and run outside the mailbox lock, in operation order.
 func (m *Manager) SetEventCallbacks(onSend, onRecv func(string, *Message)) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -53,24 +230,136 @@ func (m *Manager) SetEventCallbacks(onSend, onRecv func(string, *Message)) {
 	m.onRecv = onRecv
 }
 
+// SetQueueCallback sets a callback invoked when a message is added to an
+// outbox, e.g. to wake the delivery loop for high-priority mail
+func (m *Manager) SetQueueCallback(onQueue func(string, *Message)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onQueue = onQueue
+}
+
+// SetLifecycleCallbacks sets callbacks invoked when a recipient first reads
+// an inbox message and when it completes one
+func (m *Manager) SetLifecycleCallbacks(onRead, onDone func(string, *Message)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onRead = onRead
+	m.onDone = onDone
+}
+
+// SetDeleteCallback sets a callback invoked when a message is deleted from
+// an inbox without being completed
+func (m *Manager) SetDeleteCallback(onDelete func(string, *Message)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onDelete = onDelete
+}
+
+// SetResponseCallback sets a callback invoked when a response closes a
+// request that declared expects_response
+func (m *Manager) SetResponseCallback(onReply func(request, response *Message)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onReply = onReply
+}
+
 // EnsureMailbox initializes mailbox for a session (no-op for in-memory)
 func (m *Manager) EnsureMailbox(sessionID string) error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
+	defer m.unlock()
 	
 	if _, ok := m.inboxes[sessionID]; !ok {
 		m.inboxes[sessionID] = []*Message{}
 		m.outboxes[sessionID] = []*Message{}
 		m.completed[sessionID] = []*Message{}
+		m.deadletter[sessionID] = []*Message{}
+		m.persist(sessionID)
 	}
 	
 	return nil
 }
 
+// RemoveMailbox deletes a participant's folders and topic subscriptions,
+// in memory and in the store, e.g. when its session is killed. Mail still
+// addressed to it then goes through the retry and dead-letter path. The
+// user mailbox is never removed.
+func (m *Manager) RemoveMailbox(participant string) {
+	m.mu.Lock()
+	defer m.unlock()
+
+	if m.removeMailboxLocked(participant) {
+		m.rebuildThreadsLocked()
+	}
+}
+
+// Prune removes the mailboxes of participants not in live that have not
+// been written for grace, e.g. those restored from the store for sessions
+// that did not survive a restart. Until then their mail can still be read.
+// The user mailbox is always kept. Returns the removed participant IDs.
+func (m *Manager) Prune(live []string, grace time.Duration) []string {
+	m.mu.Lock()
+	defer m.unlock()
+
+	keep := make(map[string]bool, len(live))
+	for _, id := range live {
+		keep[id] = true
+	}
+	cutoff := time.Now().Add(-grace)
+	var pruned []string
+	for id := range m.inboxes {
+		if keep[id] || m.dirty[id] {
+			continue
+		}
+		if m.store != nil {
+			if mtime, err := m.store.ModTime(id); err == nil && mtime.After(cutoff) {
+				continue
+			}
+		}
+		if m.removeMailboxLocked(id) {
+			pruned = append(pruned, id)
+		}
+	}
+	if len(pruned) > 0 {
+		m.rebuildThreadsLocked()
+	}
+	sort.Strings(pruned)
+	return pruned
+}
+
+// removeMailboxLocked drops a participant's mailbox and queues the deletion
+// of its store file, reporting whether it existed. Caller must hold m.mu,
+// release it with unlock and rebuild the thread index.
+func (m *Manager) removeMailboxLocked(participant string) bool {
+	if participant == "user" {
+		return false
+	}
+	if _, ok := m.inboxes[participant]; !ok {
+		return false
+	}
+	for topic := range m.topics {
+		m.dropSubscriptionLocked(participant, topic)
+	}
+	delete(m.inboxes, participant)
+	delete(m.outboxes, participant)
+	delete(m.completed, participant)
+	delete(m.deadletter, participant)
+	delete(m.drafts, participant)
+	delete(m.dirty, participant)
+	if st := m.store; st != nil {
+		// Queued behind any pending write, which would recreate the file
+		m.pending = append(m.pending, func() {
+			if err := st.Remove(participant); err != nil {
+				logging.Logger().Warn("failed to remove mailbox", zap.String("participant", participant), zap.Error(err))
+			}
+		})
+	}
+	return true
+}
+
 // AddToOutbox adds a message to a session's outbox
 func (m *Manager) AddToOutbox(sessionID string, msg *Message) error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
+	defer m.unlock()
 	
 	// Set from field if empty
 	if msg.From == "" {
@@ -79,18 +368,68 @@ func (m *Manager) AddToOutbox(sessionID string, msg *Message) error {
 	
 	// Generate ID if empty
 	if msg.ID == "" {
-		msg.ID = generateID()
+		msg.ID = NewID()
 	}
 	
 	// Set timestamp if zero
 	if msg.Timestamp == 0 {
 		msg.Timestamp = time.Now().Unix()
 	}
+	applyTTL(msg)
+	applyResponseTimeout(msg)
+	msg.QueuedAt = time.Now().Unix()
 	
 	m.outboxes[sessionID] = append(m.outboxes[sessionID], msg)
+	m.persist(sessionID)
+	m.notifyLocked(m.onQueue, sessionID, msg)
 	return nil
 }
 
+// Multicast adds one copy of msg per recipient to a session's outbox. Each
+// copy gets its own ID and all share a new correlation ID, so responses can
+// be gathered. The copies are returned in recipient order.
+func (m *Manager) Multicast(sessionID string, msg *Message, recipients []string) ([]*Message, error) {
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("no recipients")
+	}
+
+	m.mu.Lock()
+	defer m.unlock()
+
+	if msg.From == "" {
+		msg.From = sessionID
+	}
+	if msg.Timestamp == 0 {
+		msg.Timestamp = time.Now().Unix()
+	}
+	applyTTL(msg)
+	applyResponseTimeout(msg)
+	msg.QueuedAt = time.Now().Unix()
+	correlationID := NewID()
+
+	copies := make([]*Message, 0, len(recipients))
+	for _, to := range recipients {
+		c := *msg
+		c.ID = NewID()
+		c.To = to
+		c.CorrelationID = correlationID
+		if msg.Metadata != nil {
+			c.Metadata = make(map[string]interface{}, len(msg.Metadata))
+			for k, v := range msg.Metadata {
+				c.Metadata[k] = v
+			}
+		}
+		copies = append(copies, &c)
+	}
+
+	m.outboxes[sessionID] = append(m.outboxes[sessionID], copies...)
+	m.persist(sessionID)
+	for _, c := range copies {
+		m.notifyLocked(m.onQueue, sessionID, c)
+	}
+	return copies, nil
+}
+
 // HasOutbox checks if a session has messages in outbox
 func (m *Manager) HasOutbox(sessionID string) bool {
 	m.mu.RLock()
@@ -115,7 +454,7 @@ func (m *Manager) PeekOutbox(sessionID string) (*Message, error) {
 // RemoveFromOutbox removes the first message from outbox
 func (m *Manager) RemoveFromOutbox(sessionID string) error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
+	defer m.unlock()
 	
 	msgs := m.outboxes[sessionID]
 	if len(msgs) == 0 {
@@ -124,28 +463,173 @@ func (m *Manager) RemoveFromOutbox(sessionID string) error {
 	
 	msg := msgs[0]
 	m.outboxes[sessionID] = msgs[1:]
-	
-	if m.onSend != nil {
-		m.onSend(sessionID, msg)
-	}
+	m.persist(sessionID)
+	m.notifyLocked(m.onSend, sessionID, msg)
 	
 	return nil
 }
 
+// RemoveFromOutboxByID removes a delivered message from the outbox
+func (m *Manager) RemoveFromOutboxByID(sessionID, msgID string) error {
+	m.mu.Lock()
+	defer m.unlock()
+
+	msgs := m.outboxes[sessionID]
+	for i, msg := range msgs {
+		if msg.ID == msgID {
+			m.outboxes[sessionID] = append(msgs[:i:i], msgs[i+1:]...)
+			m.persist(sessionID)
+			m.notifyLocked(m.onSend, sessionID, msg)
+			return nil
+		}
+	}
+	return fmt.Errorf("message not found in outbox")
+}
+
+// RecordDeliveryFailure counts a failed delivery attempt for an outbox
+// message, records the error and schedules the next attempt after
+// delay(failed attempts so far). It returns the number of failed attempts
+// and the time of the next one.
+func (m *Manager) RecordDeliveryFailure(sessionID, msgID, reason string, delay func(failed int) time.Duration) (int, time.Time, error) {
+	m.mu.Lock()
+	defer m.unlock()
+
+	for _, msg := range m.outboxes[sessionID] {
+		if msg.ID == msgID {
+			msg.Retries++
+			next := time.Now().Add(delay(msg.Retries))
+			msg.NextAttempt = next.Unix()
+			if msg.Metadata == nil {
+				msg.Metadata = make(map[string]interface{})
+			}
+			msg.Metadata["error"] = reason
+			m.persist(sessionID)
+			return msg.Retries, next, nil
+		}
+	}
+	return 0, time.Time{}, fmt.Errorf("message not found in outbox")
+}
+
+// MoveToDeadLetter moves an undeliverable message from the outbox to the
+// sender's dead-letter folder, recording the failure reason in metadata.error.
+func (m *Manager) MoveToDeadLetter(sessionID, msgID, reason string) (*Message, error) {
+	m.mu.Lock()
+	defer m.unlock()
+
+	msgs := m.outboxes[sessionID]
+	for i, msg := range msgs {
+		if msg.ID == msgID {
+			m.outboxes[sessionID] = append(msgs[:i:i], msgs[i+1:]...)
+			if msg.Metadata == nil {
+				msg.Metadata = make(map[string]interface{})
+			}
+			msg.Metadata["error"] = reason
+			msg.NextAttempt = 0
+			m.deadletter[sessionID] = append(m.deadletter[sessionID], msg)
+			m.persist(sessionID)
+			return msg, nil
+		}
+	}
+	return nil, fmt.Errorf("message not found in outbox")
+}
+
+// Requeue moves a dead-lettered message back into the outbox with a fresh
+// set of delivery attempts. If to is non-empty the message is readdressed.
+func (m *Manager) Requeue(sessionID, msgID, to string) error {
+	m.mu.Lock()
+	defer m.unlock()
+
+	msgs := m.deadletter[sessionID]
+	for i, msg := range msgs {
+		if msg.ID == msgID {
+			m.deadletter[sessionID] = append(msgs[:i:i], msgs[i+1:]...)
+			if to != "" {
+				msg.To = to
+			}
+			msg.Retries = 0
+			msg.NextAttempt = 0
+			msg.QueuedAt = time.Now().Unix()
+			delete(msg.Metadata, "error")
+			m.outboxes[sessionID] = append(m.outboxes[sessionID], msg)
+			m.persist(sessionID)
+			return nil
+		}
+	}
+	return fmt.Errorf("message not found in deadletter")
+}
+
+// PurgeDeadLetter permanently removes dead-lettered messages: the given
+// message, or all of them when msgID is empty. It returns the number removed.
+func (m *Manager) PurgeDeadLetter(sessionID, msgID string) (int, error) {
+	m.mu.Lock()
+	defer m.unlock()
+
+	msgs := m.deadletter[sessionID]
+	if msgID == "" {
+		m.deadletter[sessionID] = []*Message{}
+		m.persist(sessionID)
+		return len(msgs), nil
+	}
+	for i, msg := range msgs {
+		if msg.ID == msgID {
+			m.deadletter[sessionID] = append(msgs[:i:i], msgs[i+1:]...)
+			m.persist(sessionID)
+			return 1, nil
+		}
+	}
+	return 0, fmt.Errorf("message not found in deadletter")
+}
+
 // DeliverToInbox delivers a message to a session's inbox
 func (m *Manager) DeliverToInbox(sessionID string, msg *Message) error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
+	defer m.unlock()
 	
 	// Check if receiver exists
 	if _, exists := m.inboxes[sessionID]; !exists {
 		return fmt.Errorf("receiver %s does not exist", sessionID)
 	}
+
+	if msg.ID == "" {
+		msg.ID = NewID()
+	}
+	applyTTL(msg)
+	applyResponseTimeout(msg)
+
+	// Reject messages the receiver has already seen
+	for _, folder := range [][]*Message{m.inboxes[sessionID], m.completed[sessionID]} {
+		for _, existing := range folder {
+			if existing.ID == msg.ID {
+				return fmt.Errorf("%w: %s", ErrDuplicateMessage, msg.ID)
+			}
+		}
+	}
 	
-	m.inboxes[sessionID] = append(m.inboxes[sessionID], msg)
+	// Record where an alias:/role:/cwd: address was routed to
+	if msg.To != sessionID {
+		if msg.Metadata == nil {
+			msg.Metadata = make(map[string]interface{})
+		}
+		msg.Metadata["resolved_to"] = sessionID
+	}
+
+	msg.DeliveredAt = time.Now().Unix()
+	m.indexThreadLocked(sessionID, msg)
+	m.inboxes[sessionID] = insertOrdered(m.inboxes[sessionID], msg)
+	request := m.closeRequestLocked(sessionID, msg)
+	if request != nil {
+		m.persist(sessionID, msg.From)
+	} else {
+		m.persist(sessionID)
+	}
 	
-	if m.onRecv != nil {
-		m.onRecv(sessionID, msg)
+	if m.archive != nil {
+		m.notifyLocked(m.archive.Received, sessionID, msg)
+	}
+	m.notifyLocked(m.onRecv, sessionID, msg)
+	if request != nil && m.onReply != nil {
+		onReply, request, response := m.onReply, request.Clone(), msg.Clone()
+		m.pending = append(m.pending, func() { onReply(request, response) })
 	}
 	
 	return nil
@@ -166,7 +650,8 @@ func (m *Manager) formatParticipant(id string) string {
 	return fmt.Sprintf("%s(%s)", alias, id)
 }
 
-// GetInbox returns all messages in inbox (copy to prevent modification)
+// GetInbox returns all messages in inbox in processing order: highest
+// priority first, then oldest first (copy to prevent modification)
 func (m *Manager) GetInbox(sessionID string) []*Message {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -177,13 +662,27 @@ func (m *Manager) GetInbox(sessionID string) []*Message {
 	return result
 }
 
-// GetOutbox returns all messages in outbox (copy to prevent modification)
+// GetOutbox returns copies of the messages in outbox, safe to read while
+// the mailbox changes them
 func (m *Manager) GetOutbox(sessionID string) []*Message {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 	
 	msgs := m.outboxes[sessionID]
 	result := make([]*Message, len(msgs))
+	for i, msg := range msgs {
+		result[i] = msg.Clone()
+	}
+	return result
+}
+
+// GetDeadLetter returns all undeliverable messages for a session (copy to prevent modification)
+func (m *Manager) GetDeadLetter(sessionID string) []*Message {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	msgs := m.deadletter[sessionID]
+	result := make([]*Message, len(msgs))
 	copy(result, msgs)
 	return result
 }
@@ -199,15 +698,40 @@ func (m *Manager) GetCompleted(sessionID string) []*Message {
 	return result
 }
 
+// Find returns copies of every message in any participant's folders that
+// satisfies match, each message once. match is called with the lock held;
+// the copies are taken under it too, so delivery and expiry cannot change
+// them while the caller uses them.
+func (m *Manager) Find(match func(*Message) bool) []*Message {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	var result []*Message
+	// Received copies first: they carry delivery and lifecycle state
+	for _, folder := range []map[string][]*Message{m.inboxes, m.completed, m.outboxes, m.deadletter} {
+		for _, msgs := range folder {
+			for _, msg := range msgs {
+				if !seen[msg.ID] && match(msg) {
+					seen[msg.ID] = true
+					result = append(result, msg.Clone())
+				}
+			}
+		}
+	}
+	return result
+}
+
 // GetPendingMessages returns all pending messages in inbox
 func (m *Manager) GetPendingMessages(sessionID string) ([]*Message, error) {
 	return m.GetInbox(sessionID), nil
 }
 
-// PullMessage retrieves and removes the first message from inbox
+// PullMessage retrieves and removes the next message (by priority) from
+// inbox. The message counts as completed: the caller has taken it over.
 func (m *Manager) PullMessage(sessionID string) (*Message, error) {
 	m.mu.Lock()
-	defer m.mu.Unlock()
+	defer m.unlock()
 	
 	msgs := m.inboxes[sessionID]
 	if len(msgs) == 0 {
@@ -216,10 +740,14 @@ func (m *Manager) PullMessage(sessionID string) (*Message, error) {
 	
 	msg := msgs[0]
 	m.inboxes[sessionID] = msgs[1:]
+	m.unindexThreadLocked(msg)
+	msg.CompletedAt = time.Now().Unix()
+	m.persist(sessionID)
+	m.doneLocked(sessionID, msg)
 	return msg, nil
 }
 
-// PeekInbox returns first message without removing it
+// PeekInbox returns the next message (by priority) without removing it
 func (m *Manager) PeekInbox(sessionID string) (*Message, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -232,6 +760,31 @@ func (m *Manager) PeekInbox(sessionID string) (*Message, error) {
 	return msgs[0], nil
 }
 
+// HasHighPriorityMessages checks if inbox holds a high or urgent message
+func (m *Manager) HasHighPriorityMessages(sessionID string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	// Inboxes are ordered by priority, so the head decides
+	msgs := m.inboxes[sessionID]
+	return len(msgs) > 0 && msgs[0].HighPriority()
+}
+
+// HasNudgeMessages checks if inbox holds a message whose type should prompt
+// an idle agent (see TypeDef.Nudge). Expired messages do not count.
+func (m *Manager) HasNudgeMessages(sessionID string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now().Unix()
+	for _, msg := range m.inboxes[sessionID] {
+		if nudges(msg.Type) && !msg.expired(now) {
+			return true
+		}
+	}
+	return false
+}
+
 // HasPendingMessages checks if inbox has messages
 func (m *Manager) HasPendingMessages(sessionID string) bool {
 	m.mu.RLock()
@@ -243,7 +796,7 @@ func (m *Manager) HasPendingMessages(sessionID string) bool {
 // CompleteMessage moves a message from inbox to completed
 func (m *Manager) CompleteMessage(sessionID, msgID string) error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
+	defer m.unlock()
 	
 	// Find and remove from inbox
 	inbox := m.inboxes[sessionID]
@@ -252,7 +805,10 @@ func (m *Manager) CompleteMessage(sessionID, msgID string) error {
 			// Remove from inbox
 			m.inboxes[sessionID] = append(inbox[:i], inbox[i+1:]...)
 			// Add to completed
+			msg.CompletedAt = time.Now().Unix()
 			m.completed[sessionID] = append(m.completed[sessionID], msg)
+			m.persist(sessionID)
+			m.doneLocked(sessionID, msg)
 			return nil
 		}
 	}
@@ -285,6 +841,13 @@ func (m *Manager) GetMessage(sessionID, msgID string) (*Message, error) {
 			return msg, nil
 		}
 	}
+
+	// Check dead letters
+	for _, msg := range m.deadletter[sessionID] {
+		if msg.ID == msgID {
+			return msg, nil
+		}
+	}
 	
 	return nil, fmt.Errorf("message not found")
 }
@@ -292,20 +855,73 @@ func (m *Manager) GetMessage(sessionID, msgID string) (*Message, error) {
 // MoveToCompleted moves a message to the completed folder
 func (m *Manager) MoveToCompleted(sessionID string, msg *Message) {
 	m.mu.Lock()
-	defer m.mu.Unlock()
+	defer m.unlock()
 
+	if msg.CompletedAt == 0 {
+		msg.CompletedAt = time.Now().Unix()
+	}
 	m.completed[sessionID] = append(m.completed[sessionID], msg)
+	m.persist(sessionID)
+	m.doneLocked(sessionID, msg)
+}
+
+// doneLocked records and reports that a participant is done with an inbox
+// message. Caller must hold m.mu and release it with unlock.
+func (m *Manager) doneLocked(participant string, msg *Message) {
+	if m.archive != nil {
+		m.notifyLocked(m.archive.Done, participant, msg)
+	}
+	m.notifyLocked(m.onDone, participant, msg)
+}
+
+// notifyLocked queues a call of fn (if set) with a copy of msg. Callbacks
+// publish events and write the archive, which may block, so they run after
+// m.mu is released, by unlock. Caller must hold m.mu.
+func (m *Manager) notifyLocked(fn func(string, *Message), participant string, msg *Message) {
+	if fn == nil {
+		return
+	}
+	msg = msg.Clone()
+	m.pending = append(m.pending, func() { fn(participant, msg) })
+}
+
+// unlock releases m.mu and runs the callbacks and store writes queued under
+// it, in the order they were queued across all goroutines. If another
+// goroutine is already running them, it runs these too and unlock returns
+// at once.
+func (m *Manager) unlock() {
+	m.mu.Unlock()
+	for m.notifying.TryLock() {
+		m.mu.Lock()
+		calls := m.pending
+		m.pending = nil
+		m.mu.Unlock()
+		for _, call := range calls {
+			call()
+		}
+		m.notifying.Unlock()
+
+		// Calls queued by goroutines that found notifying held are ours
+		m.mu.Lock()
+		more := len(m.pending) > 0
+		m.mu.Unlock()
+		if !more {
+			return
+		}
+	}
 }
 
 // DeleteFromCompleted permanently removes a message from the completed folder
 func (m *Manager) DeleteFromCompleted(sessionID, msgID string) error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
+	defer m.unlock()
 
 	completed := m.completed[sessionID]
 	for i, msg := range completed {
 		if msg.ID == msgID {
 			m.completed[sessionID] = append(completed[:i], completed[i+1:]...)
+			m.unindexThreadLocked(msg)
+			m.persist(sessionID)
 			return nil
 		}
 	}
@@ -315,12 +931,18 @@ func (m *Manager) DeleteFromCompleted(sessionID, msgID string) error {
 // DeleteFromInbox permanently removes a message from the inbox
 func (m *Manager) DeleteFromInbox(sessionID, msgID string) error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
+	defer m.unlock()
 
 	inbox := m.inboxes[sessionID]
 	for i, msg := range inbox {
 		if msg.ID == msgID {
 			m.inboxes[sessionID] = append(inbox[:i], inbox[i+1:]...)
+			m.unindexThreadLocked(msg)
+			m.persist(sessionID)
+			if m.archive != nil {
+				m.notifyLocked(m.archive.Done, sessionID, msg)
+			}
+			m.notifyLocked(m.onDelete, sessionID, msg)
 			return nil
 		}
 	}
@@ -0,0 +1,180 @@
+package mailbox
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newStored returns a manager persisting to dir
+func newStored(t *testing.T, dir string) *Manager {
+	t.Helper()
+	m := NewManager()
+	if err := m.SetStore(NewStore(dir)); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	m := newStored(t, dir)
+	m.EnsureMailbox("a")
+	m.EnsureMailbox("b")
+
+	unread := NewMessage("b", "a", MessageTypePromptRequest, "unread", "1")
+	read := NewMessage("b", "a", MessageTypePromptRequest, "read", "2")
+	done := NewMessage("b", "a", MessageTypePromptRequest, "done", "3")
+	for _, msg := range []*Message{unread, read, done} {
+		if err := m.DeliverToInbox("a", msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m.MarkRead("a", read.ID)
+	m.CompleteMessage("a", done.ID)
+
+	queued := NewMessage("a", "b", MessageTypePromptRequest, "queued", "4")
+	dead := NewMessage("a", "c", MessageTypePromptRequest, "dead", "5")
+	m.AddToOutbox("a", queued)
+	m.AddToOutbox("a", dead)
+	m.MoveToDeadLetter("a", dead.ID, "no session c")
+	m.Subscribe("a", "builds")
+
+	r := newStored(t, dir)
+	tests := []struct {
+		folder string
+		got    []*Message
+		want   []string // message IDs
+	}{
+		{"inbox", r.GetInbox("a"), []string{unread.ID, read.ID}},
+		{"completed", r.GetCompleted("a"), []string{done.ID}},
+		{"outbox", r.GetOutbox("a"), []string{queued.ID}},
+		{"deadletter", r.GetDeadLetter("a"), []string{dead.ID}},
+		{"inbox of b", r.GetInbox("b"), nil},
+	}
+	for _, tt := range tests {
+		if len(tt.got) != len(tt.want) {
+			t.Errorf("%s: got %d messages, want %d", tt.folder, len(tt.got), len(tt.want))
+			continue
+		}
+		for i, msg := range tt.got {
+			if msg.ID != tt.want[i] {
+				t.Errorf("%s[%d] = %s, want %s", tt.folder, i, msg.ID, tt.want[i])
+			}
+		}
+	}
+
+	if msg, err := r.GetMessage("a", read.ID); err != nil || msg.ReadAt == 0 {
+		t.Errorf("read receipt lost: %+v, %v", msg, err)
+	}
+	if dl := r.GetDeadLetter("a"); len(dl) == 1 && dl[0].Metadata["error"] != "no session c" {
+		t.Errorf("dead-letter reason %v", dl[0].Metadata["error"])
+	}
+	if subs := r.Subscribers("builds"); len(subs) != 1 || subs[0] != "a" {
+		t.Errorf("subscribers %v, want [a]", subs)
+	}
+}
+
+func TestRemoveMailboxDeletesFile(t *testing.T) {
+	dir := t.TempDir()
+	m := newStored(t, dir)
+	m.EnsureMailbox("a")
+	m.RemoveMailbox("a")
+
+	if _, err := os.Stat(filepath.Join(dir, "a.json")); !os.IsNotExist(err) {
+		t.Errorf("mailbox file still there: %v", err)
+	}
+	if loaded, _ := NewStore(dir).Load(); loaded["a"] != nil {
+		t.Errorf("removed mailbox restored")
+	}
+}
+
+func TestPrune(t *testing.T) {
+	grace := time.Hour
+	tests := []struct {
+		name   string
+		live   bool
+		age    time.Duration // since the mailbox file was last written
+		pruned bool
+	}{
+		{name: "live session", live: true, age: 2 * grace},
+		{name: "gone, within grace", age: grace / 2},
+		{name: "gone, past grace", age: 2 * grace, pruned: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			m := newStored(t, dir)
+			m.EnsureMailbox("a")
+			mtime := time.Now().Add(-tt.age)
+			if err := os.Chtimes(filepath.Join(dir, "a.json"), mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+
+			var live []string
+			if tt.live {
+				live = []string{"a"}
+			}
+			pruned := m.Prune(live, grace)
+			if got := len(pruned) == 1 && pruned[0] == "a"; got != tt.pruned {
+				t.Errorf("pruned %v", pruned)
+			}
+			_, err := os.Stat(filepath.Join(dir, "a.json"))
+			if exists := err == nil; exists == tt.pruned {
+				t.Errorf("mailbox file exists: %v", exists)
+			}
+		})
+	}
+}
+
+func TestRecordDeliveryFailure(t *testing.T) {
+	m := NewManager()
+	m.EnsureMailbox("a")
+	msg := NewMessage("a", "gone", MessageTypePromptRequest, "s", "b")
+	m.AddToOutbox("a", msg)
+
+	var asked []int
+	delay := func(failed int) time.Duration {
+		asked = append(asked, failed)
+		return time.Duration(failed) * time.Minute
+	}
+	for want := 1; want <= 3; want++ {
+		before := time.Now()
+		n, next, err := m.RecordDeliveryFailure("a", msg.ID, "no session gone", delay)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != want {
+			t.Errorf("attempt %d: got %d failures", want, n)
+		}
+		if wait := next.Sub(before); wait < time.Duration(want)*time.Minute || wait > time.Duration(want)*time.Minute+time.Second {
+			t.Errorf("attempt %d: next attempt in %v", want, wait)
+		}
+		if got := m.GetOutbox("a")[0]; got.Retries != want || got.NextAttempt != next.Unix() || got.Metadata["error"] != "no session gone" {
+			t.Errorf("attempt %d: outbox copy %+v", want, got)
+		}
+	}
+	if len(asked) != 3 || asked[0] != 1 || asked[2] != 3 {
+		t.Errorf("delay asked for %v, want [1 2 3]", asked)
+	}
+
+	if _, _, err := m.RecordDeliveryFailure("a", "nope", "x", delay); err == nil {
+		t.Error("no error for a message not in the outbox")
+	}
+
+	// Dead-lettered, then requeued with a fresh set of attempts
+	if _, err := m.MoveToDeadLetter("a", msg.ID, "undeliverable"); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.GetOutbox("a")) != 0 || len(m.GetDeadLetter("a")) != 1 {
+		t.Fatalf("outbox %d, dead-letter %d", len(m.GetOutbox("a")), len(m.GetDeadLetter("a")))
+	}
+	if err := m.Requeue("a", msg.ID, "b"); err != nil {
+		t.Fatal(err)
+	}
+	out := m.GetOutbox("a")
+	if len(out) != 1 || out[0].To != "b" || out[0].Retries != 0 || out[0].NextAttempt != 0 || out[0].Metadata["error"] != nil {
+		t.Errorf("requeued %+v", out)
+	}
+}
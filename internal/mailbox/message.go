@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 // MessageType defines the type of message
@@ -19,26 +21,49 @@ const (
 	MessageTypeReviewResponse   MessageType = "REVIEW_RESPONSE"   // Provide review feedback
 	MessageTypeApprovalRequest  MessageType = "APPROVAL_REQUEST"  // Request testing/approval
 	MessageTypeApprovalResponse MessageType = "APPROVAL_RESPONSE" // Provide test results
+	MessageTypeReadReceipt      MessageType = "READ_RECEIPT"      // Automatic notice that a message was read
+	MessageTypeSystemNotice     MessageType = "SYSTEM_NOTICE"     // Notice from anvillm itself (e.g. a paused mail loop)
 
 )
 
 // Message represents a structured message between sessions
 type Message struct {
-	ID        string                 `json:"id"`
-	From      string                 `json:"from"`
-	To        string                 `json:"to"`
-	Type      MessageType            `json:"type"`
-	Subject   string                 `json:"subject"`
-	Body      string                 `json:"body"`
-	Metadata  map[string]interface{} `json:"metadata,omitempty"`
-	Timestamp int64                  `json:"timestamp"`
-	Retries   int                    `json:"retries"`
+	ID            string                 `json:"id"`
+	From          string                 `json:"from"`
+	To            string                 `json:"to"`
+	Type          MessageType            `json:"type"`
+	Subject       string                 `json:"subject"`
+	Body          string                 `json:"body"`
+	Metadata      map[string]interface{} `json:"metadata,omitempty"`
+	Attachments   []Attachment           `json:"attachments,omitempty"` // files read lazily via {participant}/attachments/
+	Timestamp     int64                  `json:"timestamp"`
+	Retries       int                    `json:"retries"`                  // failed delivery attempts so far
+	NextAttempt   int64                  `json:"next_attempt,omitempty"`   // unix time of the next delivery attempt
+	InReplyTo     string                 `json:"in_reply_to,omitempty"`    // ID of the message this one answers
+	ThreadID      string                 `json:"thread_id,omitempty"`      // ID of the thread root (assigned on delivery)
+	CorrelationID string                 `json:"correlation_id,omitempty"` // shared by all copies of a multicast message
+	ExpiresAt     int64                  `json:"expires_at,omitempty"`     // unix time after which the message is dropped
+	TTL           int64                  `json:"ttl,omitempty"`            // seconds to live; sets expires_at when queued
+	Priority      string                 `json:"priority,omitempty"`       // low, normal (default), high, urgent
+	Receipt       bool                   `json:"receipt,omitempty"`        // send a READ_RECEIPT to the sender on first read
+	QueuedAt      int64                  `json:"queued_at,omitempty"`      // unix time the message entered the sender's outbox
+	DeliveredAt   int64                  `json:"delivered_at,omitempty"`   // unix time it reached the recipient's inbox
+	ReadAt        int64                  `json:"read_at,omitempty"`        // unix time the recipient first read it
+	CompletedAt   int64                  `json:"completed_at,omitempty"`   // unix time the recipient completed it
+
+	// Request/response correlation
+	ExpectsResponse bool   `json:"expects_response,omitempty"` // a *_RESPONSE with in_reply_to is expected
+	RespondBy       int64  `json:"respond_by,omitempty"`       // unix time the response is due
+	ResponseTimeout int64  `json:"response_timeout,omitempty"` // seconds to respond; sets respond_by when queued
+	RespondedAt     int64  `json:"responded_at,omitempty"`     // unix time the first response arrived
+	ResponseID      string `json:"response_id,omitempty"`      // ID of that response
+	Overdue         bool   `json:"overdue,omitempty"`          // respond_by passed without a response
 }
 
 // NewMessage creates a new message with generated ID and timestamp
 func NewMessage(from, to string, msgType MessageType, subject, body string) *Message {
 	return &Message{
-		ID:        generateID(),
+		ID:        NewID(),
 		From:      from,
 		To:        to,
 		Type:      msgType,
@@ -49,6 +74,23 @@ func NewMessage(from, to string, msgType MessageType, subject, body string) *Mes
 	}
 }
 
+// Clone returns a copy of the message that shares no mutable state with it
+// (metadata and attachments are copied), safe to use after the mailbox lock
+// is released
+func (m *Message) Clone() *Message {
+	c := *m
+	if m.Metadata != nil {
+		c.Metadata = make(map[string]interface{}, len(m.Metadata))
+		for k, v := range m.Metadata {
+			c.Metadata[k] = v
+		}
+	}
+	if m.Attachments != nil {
+		c.Attachments = append([]Attachment(nil), m.Attachments...)
+	}
+	return &c
+}
+
 // ToJSON serializes the message to JSON
 func (m *Message) ToJSON() ([]byte, error) {
 	return json.MarshalIndent(m, "", "  ")
@@ -61,19 +103,38 @@ func FromJSON(data []byte) (*Message, error) {
 	return &msg, err
 }
 
-func generateID() string {
-	return fmt.Sprintf("msg-%d", time.Now().Unix())
-}
+// DecodeMail parses a message written to a mail file. Unlike FromJSON it
+// accepts "to" either as a single address or as an array of addresses; the
+// addresses are returned separately and msg.To is left empty.
+func DecodeMail(data []byte) (*Message, []string, error) {
+	msg := &Message{}
+	aux := struct {
+		*Message
+		To json.RawMessage `json:"to"` // shadows Message.To
+	}{Message: msg}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return nil, nil, err
+	}
 
-// ValidateMessageType checks if the message type is valid
-func ValidateMessageType(msgType MessageType) error {
-	switch msgType {
-	case MessageTypePromptResponse,
-		MessageTypePromptRequest, MessageTypeQueryRequest, MessageTypeQueryResponse,
-		MessageTypeReviewRequest, MessageTypeReviewResponse,
-		MessageTypeApprovalRequest, MessageTypeApprovalResponse:
-		return nil
-	default:
-		return fmt.Errorf("invalid message type. valid types are: PROMPT_RESPONSE, PROMPT_REQUEST, QUERY_REQUEST, QUERY_RESPONSE, REVIEW_REQUEST, REVIEW_RESPONSE, APPROVAL_REQUEST, APPROVAL_RESPONSE")
+	var to []string
+	if len(aux.To) > 0 && aux.To[0] == '[' {
+		if err := json.Unmarshal(aux.To, &to); err != nil {
+			return nil, nil, fmt.Errorf("to: %w", err)
+		}
+	} else if len(aux.To) > 0 && string(aux.To) != "null" {
+		var addr string
+		if err := json.Unmarshal(aux.To, &addr); err != nil {
+			return nil, nil, fmt.Errorf("to: %w", err)
+		}
+		to = []string{addr}
 	}
+	return msg, to, nil
+}
+
+// NewID returns a new message ID. IDs are UUIDv7 strings: collision-free
+// across messages created in the same second, and lexically sortable by
+// creation time (monotonic within the process), so sorting a folder by ID
+// yields chronological order.
+func NewID() string {
+	return uuid.Must(uuid.NewV7()).String()
 }
@@ -0,0 +1,60 @@
+package mailbox
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Priority levels, lowest to highest. An empty priority means normal.
+const (
+	PriorityLow    = "low"
+	PriorityNormal = "normal"
+	PriorityHigh   = "high"
+	PriorityUrgent = "urgent"
+)
+
+var priorityRank = map[string]int{
+	PriorityLow:    0,
+	"":             1,
+	PriorityNormal: 1,
+	PriorityHigh:   2,
+	PriorityUrgent: 3,
+}
+
+// ValidatePriority checks if the message priority is valid (empty is normal)
+func ValidatePriority(priority string) error {
+	if _, ok := priorityRank[priority]; !ok {
+		return fmt.Errorf("invalid priority. valid priorities are: low, normal, high, urgent")
+	}
+	return nil
+}
+
+// HighPriority reports whether the message is high or urgent priority
+func (msg *Message) HighPriority() bool {
+	return priorityRank[msg.Priority] >= priorityRank[PriorityHigh]
+}
+
+// before reports whether a should be processed before b: higher priority
+// first, then older first
+func before(a, b *Message) bool {
+	if ra, rb := priorityRank[a.Priority], priorityRank[b.Priority]; ra != rb {
+		return ra > rb
+	}
+	return a.Timestamp < b.Timestamp
+}
+
+// insertOrdered inserts msg into an inbox kept in processing order, after
+// any messages of equal rank (stable)
+func insertOrdered(msgs []*Message, msg *Message) []*Message {
+	i := sort.Search(len(msgs), func(i int) bool { return before(msg, msgs[i]) })
+	msgs = append(msgs, nil)
+	copy(msgs[i+1:], msgs[i:])
+	msgs[i] = msg
+	return msgs
+}
+
+// sortInbox puts a loaded inbox into processing order
+func sortInbox(msgs []*Message) []*Message {
+	sort.SliceStable(msgs, func(i, j int) bool { return before(msgs[i], msgs[j]) })
+	return msgs
+}
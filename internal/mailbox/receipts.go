@@ -0,0 +1,51 @@
+package mailbox
+
+import (
+	"fmt"
+	"time"
+)
+
+// MarkRead records that a participant read a message in its inbox. Only the
+// first read counts: it sets ReadAt, fires the read callback and, if the
+// sender asked for one, queues a READ_RECEIPT back to the sender. Later
+// reads are no-ops.
+func (m *Manager) MarkRead(participant, msgID string) error {
+	m.mu.Lock()
+	defer m.unlock()
+
+	for _, msg := range m.inboxes[participant] {
+		if msg.ID != msgID {
+			continue
+		}
+		if msg.ReadAt != 0 {
+			return nil
+		}
+		msg.ReadAt = time.Now().Unix()
+
+		var receipt *Message
+		if msg.Receipt && msg.Type != MessageTypeReadReceipt && msg.From != participant {
+			receipt = newReceipt(participant, msg)
+			m.outboxes[participant] = append(m.outboxes[participant], receipt)
+		}
+		m.persist(participant)
+
+		m.notifyLocked(m.onRead, participant, msg)
+		if receipt != nil {
+			m.notifyLocked(m.onQueue, participant, receipt)
+		}
+		return nil
+	}
+	return fmt.Errorf("message not found in inbox")
+}
+
+// newReceipt builds the READ_RECEIPT for a message read by participant. It
+// replies to the original, so it lands in the same thread.
+func newReceipt(participant string, msg *Message) *Message {
+	receipt := NewMessage(participant, msg.From, MessageTypeReadReceipt,
+		"Read: "+msg.Subject, fmt.Sprintf("Message %s was read.", msg.ID))
+	receipt.InReplyTo = msg.ID
+	receipt.QueuedAt = receipt.Timestamp
+	receipt.Metadata["message_id"] = msg.ID
+	receipt.Metadata["read_at"] = msg.ReadAt
+	return receipt
+}
@@ -0,0 +1,98 @@
+package mailbox
+
+import (
+	"strings"
+	"time"
+)
+
+// Overdue describes a request reported by OverdueRequests
+type Overdue struct {
+	Participant string // recipient that has not responded
+	Request     *Message
+}
+
+// applyResponseTimeout derives respond_by from response_timeout when only
+// the latter is given
+func applyResponseTimeout(msg *Message) {
+	if msg.ExpectsResponse && msg.RespondBy == 0 && msg.ResponseTimeout > 0 {
+		ts := msg.Timestamp
+		if ts == 0 {
+			ts = time.Now().Unix()
+		}
+		msg.RespondBy = ts + msg.ResponseTimeout
+	}
+}
+
+// IsResponse reports whether a message type answers a request (*_RESPONSE)
+func IsResponse(msgType MessageType) bool {
+	return strings.HasSuffix(string(msgType), "_RESPONSE")
+}
+
+// closeRequestLocked marks the request a response answers as responded.
+// The response must be a *_RESPONSE with in_reply_to set, sent by the
+// request's recipient back to the requester (receiverID). Only the first
+// response closes a request. Returns the closed request, or nil. Caller must
+// hold m.mu.
+func (m *Manager) closeRequestLocked(receiverID string, resp *Message) *Message {
+	if resp.InReplyTo == "" || !IsResponse(resp.Type) {
+		return nil
+	}
+	for _, folder := range [][]*Message{m.inboxes[resp.From], m.completed[resp.From]} {
+		for _, req := range folder {
+			if req.ID != resp.InReplyTo {
+				continue
+			}
+			if !req.ExpectsResponse || req.RespondedAt != 0 || req.From != receiverID {
+				return nil
+			}
+			req.RespondedAt = time.Now().Unix()
+			req.ResponseID = resp.ID
+			return req
+		}
+	}
+	return nil
+}
+
+// OverdueRequests returns the delivered requests whose respond_by time has
+// passed without a response. Each request is reported once: it is flagged
+// overdue so later calls skip it.
+func (m *Manager) OverdueRequests(now time.Time) []Overdue {
+	m.mu.Lock()
+	defer m.unlock()
+
+	var result []Overdue
+	for id := range m.inboxes {
+		changed := false
+		for _, folder := range [][]*Message{m.inboxes[id], m.completed[id]} {
+			for _, req := range folder {
+				if !req.ExpectsResponse || req.RespondedAt != 0 || req.Overdue ||
+					req.RespondBy == 0 || req.RespondBy > now.Unix() {
+					continue
+				}
+				req.Overdue = true
+				result = append(result, Overdue{Participant: id, Request: req})
+				changed = true
+			}
+		}
+		if changed {
+			m.persist(id)
+		}
+	}
+	return result
+}
+
+// ResponseTo returns the first *_RESPONSE in a participant's inbox or
+// completed folder that answers the given request
+func (m *Manager) ResponseTo(participant, requestID string) (*Message, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, folder := range [][]*Message{m.inboxes[participant], m.completed[participant]} {
+		for _, msg := range folder {
+			if msg.InReplyTo == requestID && IsResponse(msg.Type) {
+				return msg, true
+			}
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,244 @@
+package mailbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// SchemaError lists every schema violation found in a message
+type SchemaError struct {
+	Violations []string
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("message does not match schema: %s", strings.Join(e.Violations, "; "))
+}
+
+// ValidateSchema checks a message's body and metadata against the schemas
+// declared for its type. A body schema implies the body must be JSON.
+// Returns a *SchemaError listing all violations, or nil.
+//
+// Supported JSON Schema keywords: type, enum, const, properties, required,
+// additionalProperties (boolean or schema), items, minItems, maxItems,
+// minLength, maxLength, pattern, minimum, maximum.
+func ValidateSchema(msg *Message) error {
+	t, ok := LookupType(string(msg.Type))
+	if !ok {
+		return nil
+	}
+
+	var violations []string
+	if t.BodySchema != nil {
+		var body any
+		if err := json.Unmarshal([]byte(msg.Body), &body); err != nil {
+			violations = append(violations, fmt.Sprintf("body: must be JSON for type %s: %v", t.Name, err))
+		} else {
+			violations = append(violations, checkSchema("body", t.BodySchema, body)...)
+		}
+	}
+	if t.MetadataSchema != nil {
+		// Round-trip through JSON so values have their JSON types
+		var metadata any = map[string]any{}
+		if msg.Metadata != nil {
+			data, _ := json.Marshal(msg.Metadata)
+			json.Unmarshal(data, &metadata)
+		}
+		violations = append(violations, checkSchema("metadata", t.MetadataSchema, metadata)...)
+	}
+
+	if len(violations) > 0 {
+		return &SchemaError{Violations: violations}
+	}
+	return nil
+}
+
+// checkSchema validates a decoded JSON value against a schema and returns
+// the violations, each prefixed with the path of the offending value
+func checkSchema(path string, schema map[string]any, value any) []string {
+	var v []string
+	fail := func(format string, args ...any) {
+		v = append(v, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if want, ok := schema["type"]; ok {
+		types := stringList(want)
+		matched := false
+		for _, t := range types {
+			if hasType(value, t) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			fail("expected %s, got %s", strings.Join(types, " or "), jsonType(value))
+			return v // further keywords would only repeat the mismatch
+		}
+	}
+
+	if enum, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, e := range enum {
+			if jsonEqual(e, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("must be one of %s", compactJSON(enum))
+		}
+	}
+	if c, ok := schema["const"]; ok && !jsonEqual(c, value) {
+		fail("must be %s", compactJSON(c))
+	}
+
+	switch val := value.(type) {
+	case string:
+		n := len([]rune(val))
+		if min, ok := number(schema["minLength"]); ok && float64(n) < min {
+			fail("length %d is less than minLength %v", n, min)
+		}
+		if max, ok := number(schema["maxLength"]); ok && float64(n) > max {
+			fail("length %d is greater than maxLength %v", n, max)
+		}
+		if p, ok := schema["pattern"].(string); ok {
+			if re, err := regexp.Compile(p); err != nil {
+				fail("invalid pattern %q in schema", p)
+			} else if !re.MatchString(val) {
+				fail("does not match pattern %q", p)
+			}
+		}
+
+	case float64:
+		if min, ok := number(schema["minimum"]); ok && val < min {
+			fail("%v is less than minimum %v", val, min)
+		}
+		if max, ok := number(schema["maximum"]); ok && val > max {
+			fail("%v is greater than maximum %v", val, max)
+		}
+
+	case []any:
+		if min, ok := number(schema["minItems"]); ok && float64(len(val)) < min {
+			fail("has %d items, fewer than minItems %v", len(val), min)
+		}
+		if max, ok := number(schema["maxItems"]); ok && float64(len(val)) > max {
+			fail("has %d items, more than maxItems %v", len(val), max)
+		}
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range val {
+				v = append(v, checkSchema(fmt.Sprintf("%s[%d]", path, i), items, item)...)
+			}
+		}
+
+	case map[string]any:
+		for _, name := range stringList(schema["required"]) {
+			if _, ok := val[name]; !ok {
+				fail("missing required property %q", name)
+			}
+		}
+		props, _ := schema["properties"].(map[string]any)
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if ps, ok := props[k].(map[string]any); ok {
+				v = append(v, checkSchema(path+"."+k, ps, val[k])...)
+				continue
+			}
+			switch ap := schema["additionalProperties"].(type) {
+			case bool:
+				if !ap {
+					fail("unexpected property %q", k)
+				}
+			case map[string]any:
+				v = append(v, checkSchema(path+"."+k, ap, val[k])...)
+			}
+		}
+	}
+	return v
+}
+
+// hasType reports whether a decoded JSON value is of a JSON Schema type
+func hasType(value any, t string) bool {
+	switch t {
+	case "integer":
+		f, ok := value.(float64)
+		return ok && f == math.Trunc(f)
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	default:
+		return jsonType(value) == t
+	}
+}
+
+// jsonType names the JSON type of a decoded value
+func jsonType(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// stringList accepts a string or a list of strings (schemas loaded from YAML
+// or JSON)
+func stringList(v any) []string {
+	switch val := v.(type) {
+	case string:
+		return []string{val}
+	case []any:
+		var out []string
+		for _, s := range val {
+			if str, ok := s.(string); ok {
+				out = append(out, str)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// number converts a schema keyword value (int from YAML, float64 from JSON)
+func number(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// jsonEqual compares a schema value (possibly YAML-typed) with a decoded
+// JSON value by their JSON encodings
+func jsonEqual(a, b any) bool {
+	return compactJSON(a) == compactJSON(b)
+}
+
+func compactJSON(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
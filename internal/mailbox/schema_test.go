@@ -0,0 +1,225 @@
+package mailbox
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const taskSchema = `
+type: object
+required: [task, priority]
+additionalProperties: false
+properties:
+  task:
+    type: string
+    minLength: 1
+  priority:
+    enum: [low, normal, high]
+  estimate:
+    type: integer
+    minimum: 1
+    maximum: 10
+  files:
+    type: array
+    maxItems: 2
+    items:
+      type: string
+      pattern: "^[a-z/]+\\.go$"
+  owner:
+    type: object
+    required: [name]
+    properties:
+      name: {type: string}
+      team: {enum: [core, infra]}
+`
+
+func TestCheckSchema(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string // YAML, as written in message-types.yaml
+		value  string // JSON
+		want   []string
+	}{
+		{
+			name:   "valid",
+			schema: taskSchema,
+			value:  `{"task":"fix","priority":"high","estimate":3,"files":["a/b.go"],"owner":{"name":"x","team":"core"}}`,
+		},
+		{
+			name:   "missing required",
+			schema: taskSchema,
+			value:  `{}`,
+			want: []string{
+				`body: missing required property "task"`,
+				`body: missing required property "priority"`,
+			},
+		},
+		{
+			name:   "type mismatch at root",
+			schema: taskSchema,
+			value:  `["fix"]`,
+			want:   []string{"body: expected object, got array"},
+		},
+		{
+			name:   "type mismatch in property",
+			schema: taskSchema,
+			value:  `{"task":42,"priority":"low"}`,
+			want:   []string{"body.task: expected string, got number"},
+		},
+		{
+			name:   "integer rejects fraction",
+			schema: taskSchema,
+			value:  `{"task":"fix","priority":"low","estimate":2.5}`,
+			want:   []string{"body.estimate: expected integer, got number"},
+		},
+		{
+			name:   "enum",
+			schema: taskSchema,
+			value:  `{"task":"fix","priority":"urgent"}`,
+			want:   []string{`body.priority: must be one of ["low","normal","high"]`},
+		},
+		{
+			name:   "bounds",
+			schema: taskSchema,
+			value:  `{"task":"","priority":"low","estimate":11}`,
+			want: []string{
+				"body.estimate: 11 is greater than maximum 10",
+				"body.task: length 0 is less than minLength 1",
+			},
+		},
+		{
+			name:   "array items",
+			schema: taskSchema,
+			value:  `{"task":"fix","priority":"low","files":["a.go","B.txt",3]}`,
+			want: []string{
+				"body.files: has 3 items, more than maxItems 2",
+				`body.files[1]: does not match pattern "^[a-z/]+\\.go$"`,
+				"body.files[2]: expected string, got number",
+			},
+		},
+		{
+			name:   "nested object",
+			schema: taskSchema,
+			value:  `{"task":"fix","priority":"low","owner":{"team":"sales"}}`,
+			want: []string{
+				`body.owner: missing required property "name"`,
+				`body.owner.team: must be one of ["core","infra"]`,
+			},
+		},
+		{
+			name:   "additional properties",
+			schema: taskSchema,
+			value:  `{"task":"fix","priority":"low","extra":true}`,
+			want:   []string{`body: unexpected property "extra"`},
+		},
+		{
+			name:   "additional properties schema",
+			schema: "type: object\nadditionalProperties: {type: number}",
+			value:  `{"a":1,"b":"2"}`,
+			want:   []string{"body.b: expected number, got string"},
+		},
+		{
+			name:   "type list and const",
+			schema: "type: [string, \"null\"]\nconst: done",
+			value:  `null`,
+			want:   []string{`body: must be "done"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var schema map[string]any
+			if err := yaml.Unmarshal([]byte(tt.schema), &schema); err != nil {
+				t.Fatalf("schema: %v", err)
+			}
+			var value any
+			if err := json.Unmarshal([]byte(tt.value), &value); err != nil {
+				t.Fatalf("value: %v", err)
+			}
+			got := checkSchema("body", schema, value)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got  %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "message-types.yaml")
+	types := `
+types:
+  - name: TASK_REQUEST
+    body_schema:
+      type: object
+      required: [task]
+    metadata_schema:
+      type: object
+      properties:
+        ticket: {type: integer}
+`
+	if err := os.WriteFile(path, []byte(types), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadTypes(path); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		registry.Lock()
+		defer registry.Unlock()
+		resetTypes()
+	})
+
+	tests := []struct {
+		name     string
+		msgType  MessageType
+		body     string
+		metadata map[string]interface{}
+		want     []string
+	}{
+		{name: "valid", msgType: "TASK_REQUEST", body: `{"task":"fix"}`, metadata: map[string]interface{}{"ticket": 7}},
+		{name: "no schema", msgType: MessageTypePromptRequest, body: "plain text"},
+		{
+			name:    "body not JSON",
+			msgType: "TASK_REQUEST",
+			body:    "fix it",
+			want:    []string{"body: must be JSON for type TASK_REQUEST: invalid character 'i' in literal false (expecting 'a')"},
+		},
+		{
+			name:     "body and metadata",
+			msgType:  "TASK_REQUEST",
+			body:     `{}`,
+			metadata: map[string]interface{}{"ticket": "7"},
+			want: []string{
+				`body: missing required property "task"`,
+				"metadata.ticket: expected integer, got string",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := NewMessage("user", "a", tt.msgType, "s", tt.body)
+			msg.Metadata = tt.metadata
+			err := ValidateSchema(msg)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var se *SchemaError
+			if !errors.As(err, &se) {
+				t.Fatalf("got %v, want *SchemaError", err)
+			}
+			if !reflect.DeepEqual(se.Violations, tt.want) {
+				t.Errorf("got  %q\nwant %q", se.Violations, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package mailbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Store persists mailbox folders to disk so that undelivered and unread mail
+// survives daemon restarts. Each participant is kept in its own JSON file
+// (<dir>/<participant>.json), rewritten atomically after mutations.
+type Store struct {
+	dir string
+}
+
+// folders is the on-disk representation of a single participant's mailbox.
+type folders struct {
+	Inbox      []*Message `json:"inbox"`
+	Outbox     []*Message `json:"outbox"`
+	Completed  []*Message `json:"completed"`
+	DeadLetter []*Message `json:"deadletter"`
+	Topics     []string   `json:"topics,omitempty"` // topic subscriptions
+}
+
+// NewStore creates a store rooted at dir. The directory is created on first save.
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// Dir returns the directory the store writes to
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+func (s *Store) path(participant string) string {
+	return filepath.Join(s.dir, participant+".json")
+}
+
+// Save writes a participant's folders to disk via a temp file and rename,
+// so a crash mid-write never leaves a truncated mailbox behind.
+func (s *Store) Save(participant string, f *folders) error {
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	return s.write(participant, data)
+}
+
+// write stores an encoded mailbox, as Save does
+func (s *Store) write(participant string, data []byte) error {
+	if participant == "" || participant != filepath.Base(participant) {
+		return fmt.Errorf("invalid participant id: %q", participant)
+	}
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.dir, participant+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(participant))
+}
+
+// Load reads every persisted mailbox, keyed by participant ID.
+// A missing store directory is not an error (first run).
+func (s *Store) Load() (map[string]*folders, error) {
+	entries, err := os.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return map[string]*folders{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]*folders)
+	var errs []string
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		participant := strings.TrimSuffix(entry.Name(), ".json")
+		data, err := os.ReadFile(filepath.Join(s.dir, entry.Name()))
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", entry.Name(), err))
+			continue
+		}
+		var f folders
+		if err := json.Unmarshal(data, &f); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", entry.Name(), err))
+			continue
+		}
+		result[participant] = &f
+	}
+
+	if len(errs) > 0 {
+		return result, fmt.Errorf("failed to load mailboxes: %s", strings.Join(errs, "; "))
+	}
+	return result, nil
+}
+
+// ModTime reports when a participant's mailbox file was last written
+func (s *Store) ModTime(participant string) (time.Time, error) {
+	info, err := os.Stat(s.path(participant))
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+// Remove deletes a participant's mailbox file. A missing file is not an error.
+func (s *Store) Remove(participant string) error {
+	if participant == "" || participant != filepath.Base(participant) {
+		return fmt.Errorf("invalid participant id: %q", participant)
+	}
+	if err := os.Remove(s.path(participant)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
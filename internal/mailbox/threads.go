@@ -0,0 +1,161 @@
+package mailbox
+
+import (
+	"fmt"
+	"sort"
+)
+
+// threadEntry records where an indexed message sits
+type threadEntry struct {
+	thread   string
+	receiver string
+}
+
+// indexThreadLocked assigns msg to a thread and records both the sender and
+// the receiver as participants. A message without thread_id joins the thread
+// of the message it replies to, provided the sender took part in that thread
+// (so a reply cannot be used to read someone else's conversation); anything
+// else starts a new thread rooted at its own ID. Caller must hold m.mu.
+func (m *Manager) indexThreadLocked(receiverID string, msg *Message) {
+	if msg.ThreadID == "" {
+		switch {
+		case msg.InReplyTo == "":
+			msg.ThreadID = msg.ID
+		case m.threadOf[msg.InReplyTo].thread != "":
+			if tid := m.threadOf[msg.InReplyTo].thread; m.participantThreads[msg.From][tid] > 0 {
+				msg.ThreadID = tid
+			} else {
+				msg.ThreadID = msg.ID
+			}
+		default:
+			msg.ThreadID = msg.ID
+		}
+	}
+
+	if _, indexed := m.threadOf[msg.ID]; indexed {
+		return
+	}
+	m.threadOf[msg.ID] = threadEntry{thread: msg.ThreadID, receiver: receiverID}
+	m.threads[msg.ThreadID] = append(m.threads[msg.ThreadID], msg)
+
+	for _, p := range []string{msg.From, receiverID} {
+		if p == "" {
+			continue
+		}
+		if m.participantThreads[p] == nil {
+			m.participantThreads[p] = make(map[string]int)
+		}
+		m.participantThreads[p][msg.ThreadID]++
+	}
+}
+
+// unindexThreadLocked removes a message that left the inbox and completed
+// folders (pulled, deleted or purged), so the live index always matches the
+// one rebuilt from the store at startup. A participant leaves a thread with
+// its last message there. Caller must hold m.mu.
+func (m *Manager) unindexThreadLocked(msg *Message) {
+	entry, indexed := m.threadOf[msg.ID]
+	if !indexed {
+		return
+	}
+	delete(m.threadOf, msg.ID)
+
+	msgs := m.threads[entry.thread]
+	for i, other := range msgs {
+		if other.ID == msg.ID {
+			msgs = append(msgs[:i:i], msgs[i+1:]...)
+			break
+		}
+	}
+	if len(msgs) == 0 {
+		delete(m.threads, entry.thread)
+	} else {
+		m.threads[entry.thread] = msgs
+	}
+
+	for _, p := range []string{msg.From, entry.receiver} {
+		if p == "" || m.participantThreads[p] == nil {
+			continue
+		}
+		if m.participantThreads[p][entry.thread]--; m.participantThreads[p][entry.thread] <= 0 {
+			delete(m.participantThreads[p], entry.thread)
+		}
+		if len(m.participantThreads[p]) == 0 {
+			delete(m.participantThreads, p)
+		}
+	}
+}
+
+// rebuildThreadsLocked recreates the thread index from all delivered
+// messages (inbox and completed folders), e.g. after loading from the store.
+// Caller must hold m.mu.
+func (m *Manager) rebuildThreadsLocked() {
+	m.threads = make(map[string][]*Message)
+	m.threadOf = make(map[string]threadEntry)
+	m.participantThreads = make(map[string]map[string]int)
+
+	type delivered struct {
+		receiver string
+		msg      *Message
+	}
+	var all []delivered
+	for id := range m.inboxes {
+		for _, msg := range m.inboxes[id] {
+			all = append(all, delivered{id, msg})
+		}
+		for _, msg := range m.completed[id] {
+			all = append(all, delivered{id, msg})
+		}
+	}
+
+	// Index parents before replies
+	sort.SliceStable(all, func(i, j int) bool {
+		if all[i].msg.Timestamp != all[j].msg.Timestamp {
+			return all[i].msg.Timestamp < all[j].msg.Timestamp
+		}
+		return all[i].msg.ID < all[j].msg.ID
+	})
+	for _, d := range all {
+		m.indexThreadLocked(d.receiver, d.msg)
+	}
+}
+
+// GetThreads returns the IDs of all threads a participant has sent or
+// received messages in, oldest first.
+func (m *Manager) GetThreads(participant string) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ids := make([]string, 0, len(m.participantThreads[participant]))
+	for id := range m.participantThreads[participant] {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return m.threadStartLocked(ids[i]) < m.threadStartLocked(ids[j])
+	})
+	return ids
+}
+
+// threadStartLocked returns a sort key for a thread's first message.
+func (m *Manager) threadStartLocked(threadID string) string {
+	msgs := m.threads[threadID]
+	if len(msgs) == 0 {
+		return threadID
+	}
+	return fmt.Sprintf("%020d-%s", msgs[0].Timestamp, msgs[0].ID)
+}
+
+// GetThread returns the messages of a thread in delivery order (copy to
+// prevent modification). Only participants of the thread may read it.
+func (m *Manager) GetThread(participant, threadID string) ([]*Message, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.participantThreads[participant][threadID] == 0 {
+		return nil, fmt.Errorf("thread not found")
+	}
+	msgs := m.threads[threadID]
+	result := make([]*Message, len(msgs))
+	copy(result, msgs)
+	return result, nil
+}
@@ -0,0 +1,111 @@
+package mailbox
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// TopicPrefix marks a topic address in a message's "to" field (topic:<name>)
+const TopicPrefix = "topic:"
+
+var validTopic = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9_.-]*$`)
+
+// ValidateTopic checks that a topic name is usable as a 9P file name
+func ValidateTopic(topic string) error {
+	if !validTopic.MatchString(topic) {
+		return fmt.Errorf("invalid topic %q: must match [A-Za-z0-9_-][A-Za-z0-9_.-]*", topic)
+	}
+	return nil
+}
+
+// Subscribe registers a participant's interest in a topic
+func (m *Manager) Subscribe(participant, topic string) error {
+	if err := ValidateTopic(topic); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.unlock()
+
+	if _, ok := m.inboxes[participant]; !ok {
+		return fmt.Errorf("participant %s does not exist", participant)
+	}
+	if m.topics[topic] == nil {
+		m.topics[topic] = make(map[string]bool)
+	}
+	m.topics[topic][participant] = true
+	m.persist(participant)
+	return nil
+}
+
+// Unsubscribe removes a participant from a topic
+func (m *Manager) Unsubscribe(participant, topic string) error {
+	m.mu.Lock()
+	defer m.unlock()
+
+	if !m.topics[topic][participant] {
+		return fmt.Errorf("not subscribed to %s", topic)
+	}
+	m.dropSubscriptionLocked(participant, topic)
+	m.persist(participant)
+	return nil
+}
+
+// UnsubscribeAll removes a participant from every topic (e.g. when its
+// session is killed)
+func (m *Manager) UnsubscribeAll(participant string) {
+	m.mu.Lock()
+	defer m.unlock()
+
+	for topic := range m.topics {
+		m.dropSubscriptionLocked(participant, topic)
+	}
+	m.persist(participant)
+}
+
+func (m *Manager) dropSubscriptionLocked(participant, topic string) {
+	delete(m.topics[topic], participant)
+	if len(m.topics[topic]) == 0 {
+		delete(m.topics, topic)
+	}
+}
+
+// Topics returns all topics that have at least one subscriber, sorted
+func (m *Manager) Topics() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	topics := make([]string, 0, len(m.topics))
+	for topic := range m.topics {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// Subscribers returns the participants subscribed to a topic, sorted
+func (m *Manager) Subscribers(topic string) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	subs := make([]string, 0, len(m.topics[topic]))
+	for id := range m.topics[topic] {
+		subs = append(subs, id)
+	}
+	sort.Strings(subs)
+	return subs
+}
+
+// subscriptionsLocked returns the topics a participant is subscribed to,
+// sorted. Caller must hold m.mu.
+func (m *Manager) subscriptionsLocked(participant string) []string {
+	var topics []string
+	for topic, subs := range m.topics {
+		if subs[participant] {
+			topics = append(topics, topic)
+		}
+	}
+	sort.Strings(topics)
+	return topics
+}
@@ -0,0 +1,163 @@
+package mailbox
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TypeDef describes a message type. Built-in types are always defined;
+// more can be added (or built-ins redefined) in message-types.yaml.
+type TypeDef struct {
+	Name        string `yaml:"name" json:"name"`
+	Description string `yaml:"description" json:"description"`
+	// Optional JSON Schemas for the body (when it is JSON) and the metadata
+	BodySchema     map[string]any `yaml:"body_schema,omitempty" json:"body_schema,omitempty"`
+	MetadataSchema map[string]any `yaml:"metadata_schema,omitempty" json:"metadata_schema,omitempty"`
+	// Nudge controls whether an unread message of this type prompts an idle
+	// agent to check its inbox (default true)
+	Nudge *bool `yaml:"nudge,omitempty" json:"nudge"`
+}
+
+// Nudges reports whether messages of this type trigger an idle-agent nudge
+func (t TypeDef) Nudges() bool {
+	return t.Nudge == nil || *t.Nudge
+}
+
+// typesFile is the on-disk format of message-types.yaml
+type typesFile struct {
+	Types []TypeDef `yaml:"types"`
+}
+
+var builtinTypes = []TypeDef{
+	{Name: string(MessageTypePromptRequest), Description: "User instructions to bot"},
+	{Name: string(MessageTypePromptResponse), Description: "Bot response to user prompt"},
+	{Name: string(MessageTypeQueryRequest), Description: "Request information"},
+	{Name: string(MessageTypeQueryResponse), Description: "Provide information"},
+	{Name: string(MessageTypeReviewRequest), Description: "Request code review"},
+	{Name: string(MessageTypeReviewResponse), Description: "Provide review feedback"},
+	{Name: string(MessageTypeApprovalRequest), Description: "Request testing/approval"},
+	{Name: string(MessageTypeApprovalResponse), Description: "Provide test results"},
+	{Name: string(MessageTypeReadReceipt), Description: "Automatic notice that a message was read", Nudge: new(bool)},
+	{Name: string(MessageTypeSystemNotice), Description: "Notice from anvillm itself (e.g. a paused mail loop)"},
+}
+
+var validTypeName = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+
+// registry holds the known message types in definition order
+var registry = struct {
+	sync.RWMutex
+	order []string
+	types map[string]TypeDef
+}{}
+
+func init() {
+	resetTypes()
+}
+
+func resetTypes() {
+	registry.order = nil
+	registry.types = make(map[string]TypeDef)
+	for _, t := range builtinTypes {
+		registerType(t)
+	}
+}
+
+// registerType adds or replaces a type. Caller must hold registry lock
+// (or be in init).
+func registerType(t TypeDef) {
+	if t.Nudge == nil {
+		nudge := true
+		t.Nudge = &nudge
+	}
+	if _, exists := registry.types[t.Name]; !exists {
+		registry.order = append(registry.order, t.Name)
+	}
+	registry.types[t.Name] = t
+}
+
+// TypesPath returns the path of the user-defined message type file
+func TypesPath() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".config", "anvillm", "message-types.yaml")
+}
+
+// LoadTypes (re)loads user-defined message types from a YAML file on top of
+// the built-in types. A missing file is not an error (built-ins only).
+// On error the registry is left unchanged.
+func LoadTypes(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var f typesFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	for _, t := range f.Types {
+		if !validTypeName.MatchString(t.Name) {
+			return fmt.Errorf("%s: invalid type name %q: must match [A-Z][A-Z0-9_]*", path, t.Name)
+		}
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+	resetTypes()
+	for _, t := range f.Types {
+		registerType(t)
+	}
+	return nil
+}
+
+// LookupType returns the definition of a message type
+func LookupType(name string) (TypeDef, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	t, ok := registry.types[name]
+	return t, ok
+}
+
+// Types returns all known message types: built-ins first, then
+// user-defined types in file order
+func Types() []TypeDef {
+	registry.RLock()
+	defer registry.RUnlock()
+	result := make([]TypeDef, 0, len(registry.order))
+	for _, name := range registry.order {
+		result = append(result, registry.types[name])
+	}
+	return result
+}
+
+// typeNames returns the names of all known types, in registry order
+func typeNames() []string {
+	var names []string
+	for _, t := range Types() {
+		names = append(names, t.Name)
+	}
+	return names
+}
+
+// nudges reports whether a message of the given type should prompt an idle
+// agent. Unknown types nudge, so nothing is silently ignored.
+func nudges(msgType MessageType) bool {
+	t, ok := LookupType(string(msgType))
+	return !ok || t.Nudges()
+}
+
+// ValidateMessageType checks if the message type is known
+func ValidateMessageType(msgType MessageType) error {
+	if _, ok := LookupType(string(msgType)); ok {
+		return nil
+	}
+	return fmt.Errorf("invalid message type. valid types are: %s", strings.Join(typeNames(), ", "))
+}
@@ -0,0 +1,167 @@
+package maildir
+
+import (
+	"anvillm/internal/eventbus"
+	"anvillm/internal/mailbox"
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// archived is the on-disk form of an appended event. For recv and sent
+// records Data holds the message; for done records, its lifecycle event.
+type archived struct {
+	TS     int64           `json:"ts"`
+	Source string          `json:"source"`
+	Type   string          `json:"type"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// indexLimit caps how many messages the in-memory index holds. Once the
+// archive outgrows it, the oldest are evicted and Search scans the files.
+const indexLimit = 10000
+
+// load indexes every record already in the archive
+func (w *Writer) load() {
+	scanArchive(w.baseDir, w.indexLine)
+}
+
+// scanArchive calls fn with every line of the archive files under dir, per
+// participant and in date order. Unreadable files and lines are skipped.
+func scanArchive(dir string, fn func(line []byte)) {
+	files, _ := filepath.Glob(filepath.Join(dir, "*", "*.jsonl"))
+	for _, path := range files {
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+		for scanner.Scan() {
+			fn(scanner.Bytes())
+		}
+		f.Close()
+	}
+}
+
+// parseMessage returns the message an archived sent or recv record holds,
+// or nil for other records
+func parseMessage(ev *archived) *mailbox.Message {
+	switch ev.Type {
+	case eventbus.EventUserSend, eventbus.EventBotSend, eventbus.EventUserRecv, eventbus.EventBotRecv:
+	default:
+		return nil
+	}
+	var msg mailbox.Message
+	if err := json.Unmarshal(ev.Data, &msg); err != nil || msg.ID == "" {
+		return nil
+	}
+	return &msg
+}
+
+// indexLine adds one archived event to the index, evicting the oldest
+// message if it is full. The sent and recv records of a message share its
+// ID; the later one wins, so the index holds the most complete copy.
+// Caller must hold w.mu (or be in New).
+func (w *Writer) indexLine(line []byte) {
+	var ev archived
+	if err := json.Unmarshal(line, &ev); err != nil {
+		return
+	}
+
+	switch ev.Type {
+	case eventbus.EventMessageCompleted, eventbus.EventMessageDeleted, eventbus.EventMessageExpired:
+		var ref struct {
+			ID string `json:"id"`
+		}
+		if json.Unmarshal(ev.Data, &ref) == nil && ref.ID != "" {
+			w.done[ref.ID] = true
+		}
+		return
+	}
+
+	msg := parseMessage(&ev)
+	if msg == nil {
+		return
+	}
+	if _, ok := w.index[msg.ID]; !ok {
+		w.order = append(w.order, msg.ID)
+	}
+	w.index[msg.ID] = msg
+	for len(w.index) > w.limit {
+		delete(w.index, w.order[0])
+		w.order = w.order[1:]
+		w.truncated = true
+	}
+	if ev.Type == eventbus.EventUserRecv || ev.Type == eventbus.EventBotRecv {
+		w.delivered[msg.ID] = delivery{recipient: ev.Source, ts: ev.TS}
+	}
+}
+
+// Search returns the archived messages matching q, newest first, at most
+// q.Limit of them. The returned messages must not be modified. If the
+// archive holds more messages than the index, the files are scanned.
+func (w *Writer) Search(q Query) []*mailbox.Message {
+	w.mu.Lock()
+	if w.truncated {
+		w.mu.Unlock()
+		return w.scan(q)
+	}
+	var results []*mailbox.Message
+	for _, msg := range w.index {
+		if q.Match(msg) {
+			results = append(results, msg)
+		}
+	}
+	w.mu.Unlock()
+	return Newest(results, q.Limit)
+}
+
+// scan searches the archive files, keeping only the newest q.Limit matches
+// in memory as it goes
+func (w *Writer) scan(q Query) []*mailbox.Message {
+	matches := make(map[string]*mailbox.Message)
+	scanArchive(w.baseDir, func(line []byte) {
+		var ev archived
+		if json.Unmarshal(line, &ev) != nil {
+			return
+		}
+		msg := parseMessage(&ev)
+		if msg == nil || !q.Match(msg) {
+			return
+		}
+		matches[msg.ID] = msg
+		if q.Limit > 0 && len(matches) >= 2*q.Limit {
+			kept := make([]*mailbox.Message, 0, len(matches))
+			for _, m := range matches {
+				kept = append(kept, m)
+			}
+			clear(matches)
+			for _, m := range Newest(kept, q.Limit) {
+				matches[m.ID] = m
+			}
+		}
+	})
+	results := make([]*mailbox.Message, 0, len(matches))
+	for _, msg := range matches {
+		results = append(results, msg)
+	}
+	return Newest(results, q.Limit)
+}
+
+// Newest sorts messages newest first (by timestamp, then ID) and keeps at
+// most limit of them
+func Newest(msgs []*mailbox.Message, limit int) []*mailbox.Message {
+	sort.Slice(msgs, func(i, j int) bool {
+		if msgs[i].Timestamp != msgs[j].Timestamp {
+			return msgs[i].Timestamp > msgs[j].Timestamp
+		}
+		return msgs[i].ID > msgs[j].ID
+	})
+	if limit > 0 && len(msgs) > limit {
+		msgs = msgs[:limit]
+	}
+	return msgs
+}
@@ -0,0 +1,71 @@
+package maildir
+
+import (
+	"anvillm/internal/eventbus"
+	"anvillm/internal/mailbox"
+	"testing"
+	"time"
+)
+
+func TestSearchPastIndexLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		limit     int // index size
+		truncated bool
+	}{
+		{name: "all indexed", limit: 10},
+		{name: "scanning the files", limit: 2, truncated: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := New(t.TempDir(), eventbus.New())
+			defer w.Close()
+			w.limit = tt.limit
+
+			var ids []string
+			for i := range 5 {
+				msg := mailbox.NewMessage("user", "a", mailbox.MessageTypePromptRequest, "s", "b")
+				msg.Timestamp = time.Now().Add(time.Duration(i) * time.Second).Unix()
+				if i%2 == 1 {
+					msg.Body = "needle"
+				}
+				w.Received("a", msg)
+				ids = append(ids, msg.ID)
+			}
+			if w.truncated != tt.truncated || len(w.index) > tt.limit {
+				t.Fatalf("truncated %v with %d indexed", w.truncated, len(w.index))
+			}
+
+			got := w.Search(Query{Text: "needle", Limit: 50})
+			if len(got) != 2 || got[0].ID != ids[3] || got[1].ID != ids[1] {
+				t.Errorf("got %v, want messages 4 and 2", got)
+			}
+			if got := w.Search(Query{To: "a", Limit: 1}); len(got) != 1 || got[0].ID != ids[4] {
+				t.Errorf("limit 1: got %v, want message 5", got)
+			}
+		})
+	}
+}
+
+func TestReplayEvicted(t *testing.T) {
+	dir := t.TempDir()
+	w := New(dir, eventbus.New())
+	w.limit = 1
+	first := mailbox.NewMessage("user", "a", mailbox.MessageTypePromptRequest, "first", "b")
+	second := mailbox.NewMessage("user", "a", mailbox.MessageTypePromptRequest, "second", "b")
+	w.Received("a", first)
+	w.Received("a", second)
+	w.Close()
+	if _, ok := w.index[first.ID]; ok {
+		t.Fatal("first message still indexed")
+	}
+
+	mgr := mailbox.NewManager()
+	mgr.EnsureMailbox("a")
+	if n := w.Replay(mgr); n != 2 {
+		t.Errorf("restored %d messages, want 2", n)
+	}
+	if _, err := mgr.GetMessage("a", first.ID); err != nil {
+		t.Errorf("evicted message not restored: %v", err)
+	}
+}
@@ -0,0 +1,214 @@
+package maildir
+
+import (
+	"anvillm/internal/mailbox"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultLimit is how many results a query returns when it sets no limit
+const DefaultLimit = 50
+
+// Query selects messages. Empty fields match everything. It is parsed from
+// space-separated key=value terms, e.g.
+//
+//	from=reviewer type=REVIEW_RESPONSE since=2d text="data race"
+//
+// Keys: from, to, participant (from or to), type, id, thread, text
+// (case-insensitive substring of subject or body), since/until (a duration
+// back from now such as 30m, 12h or 2d; a date YYYY-MM-DD; RFC 3339; or unix
+// seconds) and limit.
+//
+// from, to and participant take a participant ID, or an alias:, role: or
+// bare alias term once ResolveParticipants has mapped it to session IDs.
+type Query struct {
+	From        string
+	To          string
+	Participant string
+	Type        string
+	ID          string
+	Thread      string
+	Text        string
+	Since       time.Time
+	Until       time.Time
+	Limit       int
+
+	// IDs each participant term stands for (see ResolveParticipants)
+	fromIDs, toIDs, participantIDs map[string]bool
+}
+
+// ParseQuery parses a query string. Values containing spaces can be double
+// quoted.
+func ParseQuery(s string, now time.Time) (Query, error) {
+	q := Query{Limit: DefaultLimit}
+	terms, err := splitTerms(s)
+	if err != nil {
+		return q, err
+	}
+	for _, term := range terms {
+		key, value, ok := strings.Cut(term, "=")
+		if !ok || value == "" {
+			return q, fmt.Errorf("invalid term %q: expected key=value", term)
+		}
+		switch key {
+		case "from":
+			q.From = value
+		case "to":
+			q.To = value
+		case "participant":
+			q.Participant = value
+		case "type":
+			q.Type = value
+		case "id":
+			q.ID = value
+		case "thread":
+			q.Thread = value
+		case "text":
+			q.Text = strings.ToLower(value)
+		case "since", "until":
+			t, err := parseTime(value, now)
+			if err != nil {
+				return q, fmt.Errorf("%s: %v", key, err)
+			}
+			if key == "since" {
+				q.Since = t
+			} else {
+				q.Until = t
+			}
+		case "limit":
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return q, fmt.Errorf("limit: must be a positive number")
+			}
+			q.Limit = n
+		default:
+			return q, fmt.Errorf("unknown key %q (use from, to, participant, type, id, thread, text, since, until, limit)", key)
+		}
+	}
+	return q, nil
+}
+
+// splitTerms splits on spaces, keeping double-quoted runs together
+func splitTerms(s string) ([]string, error) {
+	var terms []string
+	var cur strings.Builder
+	inQuote, inTerm := false, false
+	for _, r := range s {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+			inTerm = true
+		case !inQuote && (r == ' ' || r == '\t' || r == '\n'):
+			if inTerm {
+				terms = append(terms, cur.String())
+				cur.Reset()
+				inTerm = false
+			}
+		default:
+			cur.WriteRune(r)
+			inTerm = true
+		}
+	}
+	if inQuote {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if inTerm {
+		terms = append(terms, cur.String())
+	}
+	return terms, nil
+}
+
+// parseTime accepts a duration back from now (with a d suffix for days), a
+// date, an RFC 3339 time or unix seconds
+func parseTime(s string, now time.Time) (time.Time, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(n, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", s)
+}
+
+// ResolveParticipants maps the from, to and participant terms to the
+// participant IDs they stand for. resolve returns the session IDs for a
+// term such as alias:reviewer, role:reviewer or a bare alias. A term still
+// matches itself, so raw IDs, "user" and addresses recorded as written
+// (to may be "alias:reviewer") keep working.
+func (q *Query) ResolveParticipants(resolve func(term string) []string) {
+	ids := func(term string) map[string]bool {
+		if term == "" {
+			return nil
+		}
+		set := map[string]bool{term: true}
+		for _, id := range resolve(term) {
+			set[id] = true
+		}
+		return set
+	}
+	q.fromIDs = ids(q.From)
+	q.toIDs = ids(q.To)
+	q.participantIDs = ids(q.Participant)
+}
+
+// Match reports whether a message satisfies the query
+func (q Query) Match(msg *mailbox.Message) bool {
+	if q.From != "" && !matchID(q.fromIDs, q.From, msg.From) {
+		return false
+	}
+	if q.To != "" && !sentTo(msg, q.toIDs, q.To) {
+		return false
+	}
+	if q.Participant != "" && !matchID(q.participantIDs, q.Participant, msg.From) &&
+		!sentTo(msg, q.participantIDs, q.Participant) {
+		return false
+	}
+	if q.Type != "" && !strings.EqualFold(string(msg.Type), q.Type) {
+		return false
+	}
+	if q.ID != "" && msg.ID != q.ID {
+		return false
+	}
+	if q.Thread != "" && msg.ThreadID != q.Thread {
+		return false
+	}
+	if !q.Since.IsZero() && msg.Timestamp < q.Since.Unix() {
+		return false
+	}
+	if !q.Until.IsZero() && msg.Timestamp > q.Until.Unix() {
+		return false
+	}
+	if q.Text != "" && !strings.Contains(strings.ToLower(msg.Subject), q.Text) &&
+		!strings.Contains(strings.ToLower(msg.Body), q.Text) {
+		return false
+	}
+	return true
+}
+
+// matchID reports whether id is one of a term's resolved IDs, or the term
+// itself when it was not resolved
+func matchID(ids map[string]bool, term, id string) bool {
+	if ids == nil {
+		return id == term
+	}
+	return ids[id]
+}
+
+// sentTo reports whether a message was addressed or routed to a term
+func sentTo(msg *mailbox.Message, ids map[string]bool, term string) bool {
+	resolved, _ := msg.Metadata["resolved_to"].(string)
+	return matchID(ids, term, msg.To) || (resolved != "" && matchID(ids, term, resolved))
+}
@@ -0,0 +1,86 @@
+package maildir
+
+import (
+	"anvillm/internal/mailbox"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sinceFile records when the archive started tracking completions. Earlier
+// recv records have no matching done records, so replaying them would
+// resurrect mail that was long dealt with.
+const sinceFile = ".replay-since"
+
+// replaySince returns the completion tracking start, creating the marker
+// (as now) on first use
+func (w *Writer) replaySince() int64 {
+	path := filepath.Join(w.baseDir, sinceFile)
+	if data, err := os.ReadFile(path); err == nil {
+		if ts, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64); err == nil {
+			return ts
+		}
+	}
+	now := time.Now().Unix()
+	os.MkdirAll(w.baseDir, 0755)
+	os.WriteFile(path, []byte(strconv.FormatInt(now, 10)+"\n"), 0644)
+	return now
+}
+
+// Replay restores to mgr every archived message that was received but never
+// completed, deleted or expired, so mail whose mailbox state was lost (e.g.
+// the daemon died before the mailbox store was written) reappears in its
+// recipient's inbox. Messages the mailboxes already hold are left alone.
+// Returns the number of messages restored.
+func (w *Writer) Replay(mgr *mailbox.Manager) int {
+	w.mu.Lock()
+	pending := make(map[string][]*mailbox.Message)
+	missing := make(map[string]string) // evicted from the index: ID -> recipient
+	for id, d := range w.delivered {
+		if w.done[id] || d.ts < w.since {
+			continue
+		}
+		indexed, ok := w.index[id]
+		if !ok {
+			missing[id] = d.recipient
+			continue
+		}
+		// Restore a copy: the indexed message is shared with query results
+		data, err := json.Marshal(indexed)
+		if err != nil {
+			continue
+		}
+		var msg mailbox.Message
+		if json.Unmarshal(data, &msg) != nil {
+			continue
+		}
+		pending[d.recipient] = append(pending[d.recipient], &msg)
+	}
+	w.mu.Unlock()
+
+	if len(missing) > 0 {
+		scanArchive(w.baseDir, func(line []byte) {
+			var ev archived
+			if json.Unmarshal(line, &ev) != nil {
+				return
+			}
+			msg := parseMessage(&ev)
+			if msg == nil {
+				return
+			}
+			if recipient, ok := missing[msg.ID]; ok && ev.Source == recipient {
+				delete(missing, msg.ID)
+				pending[recipient] = append(pending[recipient], msg)
+			}
+		})
+	}
+
+	restored := 0
+	for participant, msgs := range pending {
+		restored += mgr.Restore(participant, msgs)
+	}
+	return restored
+}
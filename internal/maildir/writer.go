@@ -1,8 +1,12 @@
-// Package maildir persists messages to append-only JSONL files.
+// Package maildir persists messages to append-only JSONL files and keeps an
+// in-memory index of the most recent of them for queries. It also records when received
+// messages are completed, so the archive can be replayed as a write-ahead
+// log for the mailboxes (see Replay).
 package maildir
 
 import (
 	"anvillm/internal/eventbus"
+	"anvillm/internal/mailbox"
 	"encoding/json"
 	"os"
 	"path/filepath"
@@ -10,45 +14,102 @@ import (
 	"time"
 )
 
-// Writer subscribes to the event bus and persists messages to JSONL files.
+// Writer persists messages to JSONL files: what participants send, from the
+// event bus, and what they receive and complete, recorded directly by the
+// mailboxes (it implements mailbox.Archive).
 type Writer struct {
 	baseDir string
 	mu      sync.Mutex
 	cancel  func()
+	index   map[string]*mailbox.Message // archived messages by ID, at most limit
+	order   []string                    // index IDs, oldest first, for eviction
+	limit   int
+	// truncated is set once messages were evicted from the index
+	truncated bool
+
+	// Replay state: where each archived message was received, and which of
+	// them were completed, deleted or expired since
+	delivered map[string]delivery
+	done      map[string]bool
+	since     int64 // completion tracking start; older deliveries are not replayed
+}
+
+// delivery records the recipient of an archived message and when it arrived
+type delivery struct {
+	recipient string
+	ts        int64
 }
 
-// New creates a Writer that persists messages under baseDir.
+// New creates a Writer that persists messages under baseDir. Messages
+// already archived there are indexed before it starts.
 func New(baseDir string, bus *eventbus.Bus) *Writer {
-	w := &Writer{baseDir: baseDir}
-	ch, cancel := bus.Subscribe()
-	w.cancel = cancel
-	go w.run(ch)
+	w := &Writer{
+		baseDir:   baseDir,
+		index:     make(map[string]*mailbox.Message),
+		limit:     indexLimit,
+		delivered: make(map[string]delivery),
+		done:      make(map[string]bool),
+	}
+	// A larger queue than the default, since a dropped event is a message
+	// missing from the archive
+	sub := bus.SubscribeWith(eventbus.SubscribeOptions{Name: "maildir", Buffer: 1024})
+	w.cancel = sub.Cancel
+	w.since = w.replaySince()
+	w.load()
+	go w.run(sub.C)
 	return w
 }
 
 func (w *Writer) run(ch <-chan *eventbus.Event) {
 	for ev := range ch {
-		var suffix string
 		switch ev.Type {
-		case eventbus.EventUserRecv, eventbus.EventBotRecv:
-			suffix = "recv"
 		case eventbus.EventUserSend, eventbus.EventBotSend:
-			suffix = "sent"
-		default:
-			continue
+			w.append(ev.Source, "sent", ev.TS, ev)
 		}
-		w.append(ev.Source, suffix, ev)
 	}
 }
 
-func (w *Writer) append(agent, suffix string, ev *eventbus.Event) {
+// Received appends a delivered message to the recipient's recv records.
+// The mailbox calls it as part of the delivery, so unlike a bus event the
+// record cannot be dropped.
+func (w *Writer) Received(participant string, msg *mailbox.Message) {
+	evType := eventbus.EventBotRecv
+	if participant == "user" {
+		evType = eventbus.EventUserRecv
+	}
+	now := time.Now().Unix()
+	w.append(participant, "recv", now, archivedEvent(now, participant, evType, msg))
+}
+
+// Done appends a done record for a message its recipient completed, pulled,
+// deleted or let expire, so Replay never restores it
+func (w *Writer) Done(participant string, msg *mailbox.Message) {
+	now := time.Now().Unix()
+	w.append(participant, "done", now, archivedEvent(now, participant, eventbus.EventMessageCompleted, map[string]any{
+		"id":           msg.ID,
+		"to":           participant,
+		"completed_at": msg.CompletedAt,
+	}))
+}
+
+// archivedEvent builds a record in the format bus events are archived in
+func archivedEvent(ts int64, source, evType string, data any) map[string]any {
+	return map[string]any{
+		"ts":     ts,
+		"source": source,
+		"type":   evType,
+		"data":   data,
+	}
+}
+
+func (w *Writer) append(agent, suffix string, ts int64, record any) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
 	dir := filepath.Join(w.baseDir, agent)
 	os.MkdirAll(dir, 0755)
 
-	date := time.Unix(ev.TS, 0).Format("20060102")
+	date := time.Unix(ts, 0).Format("20060102")
 	path := filepath.Join(dir, date+"-"+suffix+".jsonl")
 
 	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
@@ -57,8 +118,10 @@ func (w *Writer) append(agent, suffix string, ev *eventbus.Event) {
 	}
 	defer f.Close()
 
-	data, _ := json.Marshal(ev)
-	f.Write(append(data, '\n'))
+	data, _ := json.Marshal(record)
+	if _, err := f.Write(append(data, '\n')); err == nil {
+		w.indexLine(data)
+	}
 }
 
 // Close stops the writer.
@@ -0,0 +1,90 @@
+package p9
+
+import (
+	"anvillm/internal/config"
+	"anvillm/internal/eventbus"
+	"anvillm/internal/session"
+	"fmt"
+	"time"
+)
+
+// callPollInterval is how often a pending call checks the user inbox for its
+// response, in case the ResponseReceived event was dropped by the bus.
+const callPollInterval = 5 * time.Second
+
+// call sends a request from the user and blocks until the correlated
+// response arrives in the user inbox or the timeout elapses. The request
+// gets expects_response (see mailbox correlation); its response_timeout or
+// respond_by bounds the wait, defaulting to config.CallTimeout. The response
+// is returned as JSON and completed, so it does not linger in user/inbox.
+func (s *Server) call(data []byte) ([]byte, error) {
+	msg, to, err := s.parseMail("user", data)
+	if err != nil {
+		return nil, err
+	}
+	if len(to) != 1 || session.IsBroadcast(to[0]) {
+		return nil, fmt.Errorf("call needs exactly one recipient")
+	}
+	msg.To = to[0]
+
+	mailMgr := s.mgr.GetMailManager()
+	if mailMgr == nil {
+		return nil, fmt.Errorf("mailbox not available")
+	}
+
+	msg.ExpectsResponse = true
+	timeout := config.CallTimeout
+	switch {
+	case msg.ResponseTimeout > 0:
+		timeout = time.Duration(msg.ResponseTimeout) * time.Second
+	case msg.RespondBy > 0:
+		timeout = time.Until(time.Unix(msg.RespondBy, 0))
+	default:
+		msg.ResponseTimeout = int64(timeout / time.Second)
+	}
+
+	// Subscribe before queueing so the response event cannot be missed
+	sub := s.events.SubscribeWith(eventbus.SubscribeOptions{Name: "user/call", Filter: eventbus.Filter{Types: []string{eventbus.EventResponseReceived}}})
+	defer sub.Cancel()
+	events := sub.C
+
+	if err := mailMgr.AddToOutbox("user", msg); err != nil {
+		return nil, fmt.Errorf("failed to add message: %v", err)
+	}
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	poll := time.NewTicker(callPollInterval)
+	defer poll.Stop()
+
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				events = nil // subscription closed; rely on polling
+				continue
+			}
+			if !isResponseTo(e, msg.ID) {
+				continue
+			}
+		case <-poll.C:
+		case <-deadline.C:
+			return nil, fmt.Errorf("timeout waiting for response to %s", msg.ID)
+		}
+
+		if resp, ok := mailMgr.ResponseTo("user", msg.ID); ok {
+			mailMgr.CompleteMessage("user", resp.ID)
+			out, _ := resp.ToJSON()
+			return append(out, '\n'), nil
+		}
+	}
+}
+
+// isResponseTo reports whether an event announces the response to requestID
+func isResponseTo(e *eventbus.Event, requestID string) bool {
+	if e.Type != eventbus.EventResponseReceived {
+		return false
+	}
+	data, ok := e.Data.(map[string]any)
+	return ok && data["id"] == requestID
+}
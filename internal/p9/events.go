@@ -0,0 +1,199 @@
+package p9
+
+import (
+	"anvillm/internal/eventbus"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"9fans.net/go/plan9"
+)
+
+// eventsView maps an event stream path to the filter it applies and, for
+// events.d/since/{seq}, the sequence number to resume after
+func eventsView(path string) (filter eventbus.Filter, since string, ok bool) {
+	if path == "/events" {
+		return filter, "", true
+	}
+	rest, ok := strings.CutPrefix(path, "/events.d/")
+	if !ok {
+		return filter, "", false
+	}
+	kind, name, _ := strings.Cut(rest, "/")
+	switch {
+	case rest == "all":
+		return filter, "", true
+	case kind == "since" && name != "":
+		return filter, name, true
+	case kind == "type" && name != "":
+		filter.Types = []string{name}
+		return filter, "", true
+	case kind == "source" && name != "":
+		filter.Sources = []string{name}
+		return filter, "", true
+	}
+	return filter, "", false
+}
+
+// openEvents subscribes a fid to the events passing filter, naming the
+// subscription after the stream for events.d/stats. With since set,
+// events are read from the journal after that sequence number and the
+// subscription only wakes the reader when more are appended (subscribing
+// first, so no append is missed). Caller must hold cs.mu.
+func (s *Server) openEvents(f *fid, filter eventbus.Filter, since string) error {
+	opts := eventbus.SubscribeOptions{Name: strings.TrimPrefix(f.path, "/"), Filter: filter}
+	if since == "" {
+		f.eventSub = s.events.SubscribeWith(opts)
+		return nil
+	}
+
+	after, err := strconv.ParseUint(since, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid sequence number %q", since)
+	}
+	journal := s.events.Journal()
+	if journal == nil {
+		return fmt.Errorf("event journal not available")
+	}
+	sub := s.events.SubscribeWith(opts)
+	reader, err := journal.Since(after, filter)
+	if err != nil {
+		sub.Cancel()
+		return err
+	}
+	f.eventSub = sub
+	f.journal = reader
+	return nil
+}
+
+// readEvents returns the next event on a stream fid, one JSON line per read
+func readEvents(f *fid, fc *plan9.Fcall) *plan9.Fcall {
+	for f.journal != nil {
+		if line, ok := f.journal.Next(); ok {
+			return &plan9.Fcall{Type: plan9.Rread, Tag: fc.Tag, Count: uint32(len(line)), Data: line}
+		}
+		if _, ok := <-f.eventSub.C; !ok {
+			return &plan9.Fcall{Type: plan9.Rread, Tag: fc.Tag, Count: 0}
+		}
+	}
+
+	var e *eventbus.Event
+	if len(f.eventQueue) > 0 {
+		e, f.eventQueue = f.eventQueue[0], f.eventQueue[1:]
+	} else {
+		for e == nil {
+			var ok bool
+			if e, ok = <-f.eventSub.C; !ok {
+				// Channel closed (subscription cancelled); signal EOF.
+				return &plan9.Fcall{Type: plan9.Rread, Tag: fc.Tag, Count: 0}
+			}
+			// After a resubscribe, skip what the old subscription served
+			// (EventsDropped has no sequence number and is never skipped)
+			if e.Seq != 0 && e.Seq <= f.eventSeq {
+				e = nil
+			}
+		}
+	}
+	if e.Seq != 0 {
+		f.eventSeq = e.Seq
+	}
+	data := eventbus.MarshalEvent(e)
+	return &plan9.Fcall{Type: plan9.Rread, Tag: fc.Tag, Count: uint32(len(data)), Data: data}
+}
+
+// configureEvents applies an expression written to a stream fid: filter
+// terms (see eventbus.ParseFilter) replace its filter, an empty expression
+// clears it, and buffer=<n> or buffer=block resubscribes with that buffer.
+// Caller must hold cs.mu.
+func (s *Server) configureEvents(f *fid, expr string) error {
+	var filterTerms []string
+	buffer, block, resize := 0, false, false
+	for _, term := range strings.Fields(expr) {
+		value, ok := strings.CutPrefix(term, "buffer=")
+		if !ok {
+			filterTerms = append(filterTerms, term)
+			continue
+		}
+		resize = true
+		if value == "block" {
+			block = true
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n > eventbus.MaxBuffer {
+			return fmt.Errorf("invalid buffer %q: expected 1-%d or block", value, eventbus.MaxBuffer)
+		}
+		buffer = n
+	}
+	filter, err := eventbus.ParseFilter(strings.Join(filterTerms, " "))
+	if err != nil {
+		return err
+	}
+
+	if len(filterTerms) > 0 || !resize {
+		f.eventSub.SetFilter(filter)
+		if f.journal != nil {
+			f.journal.SetFilter(filter)
+		}
+	}
+	if resize {
+		opts := f.eventSub.Options()
+		opts.Buffer, opts.Block = buffer, block
+		s.resubscribe(f, opts)
+	}
+	return nil
+}
+
+// resubscribe replaces a stream fid's subscription. The new one is made
+// before the old one is cancelled, so no event is missed; events still
+// queued on the old one are served first, and readEvents skips their
+// duplicates by sequence number. Journal streams only use the subscription
+// to wait, so their queue is discarded. Caller must hold cs.mu.
+func (s *Server) resubscribe(f *fid, opts eventbus.SubscribeOptions) {
+	old := f.eventSub
+	f.eventSub = s.events.SubscribeWith(opts)
+	old.Cancel()
+	for e := range old.C {
+		if f.journal == nil {
+			f.eventQueue = append(f.eventQueue, e)
+		}
+	}
+}
+
+// eventStats formats events.d/stats: one line per subscriber with its ID,
+// name, buffer size (or "block"), queued, delivered and dropped counts and
+// filter ("-" if none)
+func (s *Server) eventStats() string {
+	var lines []string
+	for _, st := range s.events.Stats() {
+		name, buffer, filter := st.Name, strconv.Itoa(st.Buffer), st.Filter
+		if name == "" {
+			name = "-"
+		}
+		if st.Block {
+			buffer = "block"
+		}
+		if filter == "" {
+			filter = "-"
+		}
+		lines = append(lines, fmt.Sprintf("%d\t%s\t%s\t%d\t%d\t%d\t%s",
+			st.ID, name, buffer, st.Queued, st.Delivered, st.Dropped, filter))
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// closeEvents cancels a fid's event subscription, if any
+func (f *fid) closeEvents() {
+	if f.eventSub != nil {
+		f.eventSub.Cancel()
+		f.eventSub = nil
+	}
+	if f.journal != nil {
+		f.journal.Close()
+		f.journal = nil
+	}
+	f.eventQueue = nil
+}
@@ -0,0 +1,60 @@
+package p9
+
+import (
+	"anvillm/internal/mailbox"
+	"anvillm/internal/maildir"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// SetMailArchive sets the maildir writer whose index mail/query searches
+// alongside the live mailboxes
+func (s *Server) SetMailArchive(w *maildir.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.archive = w
+}
+
+// query runs a maildir query over the live mailboxes (queued, unread and
+// completed mail, dead letters) and the maildir archive, and returns the
+// matches newest first as a JSON array. A message found in both is reported
+// from the live mailbox, which has its current lifecycle state.
+func (s *Server) query(data []byte) ([]byte, error) {
+	q, err := maildir.ParseQuery(strings.TrimSpace(string(data)), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	// Messages record session IDs; from=reviewer means the session(s) so named
+	q.ResolveParticipants(s.mgr.ParticipantIDs)
+
+	var results []*mailbox.Message
+	seen := make(map[string]bool)
+	if mailMgr := s.mgr.GetMailManager(); mailMgr != nil {
+		for _, msg := range maildir.Newest(mailMgr.Find(q.Match), q.Limit) {
+			seen[msg.ID] = true
+			results = append(results, msg)
+		}
+	}
+
+	s.mu.RLock()
+	archive := s.archive
+	s.mu.RUnlock()
+	if archive != nil {
+		for _, msg := range archive.Search(q) {
+			if !seen[msg.ID] {
+				results = append(results, msg)
+			}
+		}
+	}
+
+	results = maildir.Newest(results, q.Limit)
+	if results == nil {
+		results = []*mailbox.Message{}
+	}
+	out, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
@@ -4,11 +4,15 @@ package p9
 import (
 	"anvillm/internal/backend"
 	"anvillm/internal/backend/tmux"
+	"anvillm/internal/config"
 	"anvillm/internal/eventbus"
 	"anvillm/pkg/logging"
 	"anvillm/internal/mailbox"
+	"anvillm/internal/maildir"
 	"anvillm/internal/session"
+	"anvillm/internal/webhook"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -21,7 +25,6 @@ import (
 	"strings"
 	"sync"
 
-	"github.com/google/uuid"
 	"go.uber.org/zap"
 
 	"9fans.net/go/plan9"
@@ -34,12 +37,49 @@ Filesystem layout:
 anvillm/
     ctl                 (write) "new <backend> <cwd>" creates session, returns id
     list                (read)  list sessions: "id alias state pid cwd"
+    events              (read)  live events from the time of opening, one JSON event per line
+                                (blocks like tail -f); writing "type=A,B source=X" to an open
+                                stream sets its filter, "buffer=<n>" or "buffer=block" its
+                                queue (default 64, dropping)
+    events.d/           (dir)   more event streams, behaving like events
+        all             (read)  same as events
+        stats           (read)  subscribers: id, name, buffer, queued, delivered, dropped, filter
+        webhooks        (read)  webhooks.yaml deliveries: name, queued, delivered, failed, retries,
+                                last seq, last attempt, url, last result
+        since/          (dir)
+            {seq}       (read)  journaled events after sequence number {seq}, then live ones
+        type/           (dir)
+            {type}      (read)  live events of that type
+        source/         (dir)
+            {source}    (read)  live events from that source (or below it: beads -> beads/x)
+    topics/             (dir)   one file per topic with subscribers
+        {topic}         (read)  subscribed participant IDs, one per line
+    types/              (dir)   valid message types (built-in + message-types.yaml)
+        {TYPE}          (read)  type definition as JSON
+    mail/               (dir)   mail across all participants
+        query           (r/w)   write a query ("from=reviewer since=2d text=race"), then
+                                read the same fid: matching messages as a JSON array
     user/               (dir)   special user mailbox (singleton)
+        ctl             (write) "complete|delete <msg-id>", "requeue <msg-id> [to]", "purge [msg-id]",
+                                "subscribe|unsubscribe <topic>", "unpause <id> <id>" (mail loop)
         inbox/          (dir)   messages FROM bots TO user
         outbox/         (dir)   messages FROM user TO bots
         completed/      (dir)   processed messages
+        deadletter/     (dir)   undeliverable messages (see ctl: requeue, purge)
+        call            (r/w)   write a request, then read the same fid: blocks until
+                                the response arrives (or times out) and returns it
+        attachments/    (dir)   files sent with the user's messages
+            draft/              (dir) files to attach to the next message: write or create
+                {name}          (r/w) one, then send with "attachments":[{"name":"{name}"}]
+            {msg-id}/           (dir) one per message with attachments (read-only)
+                {name}          (read) attachment contents
+        threads/        (dir)   conversations the user took part in
+            {thread-id}/        (dir) one per thread
+                {msg-id}.json   (read) thread messages in delivery order
     {session-id}/
-        ctl             (write) "stop", "restart", "kill", "refresh"
+        ctl             (write) "stop", "restart", "kill", "refresh",
+                                "requeue <msg-id> [to]", "purge [msg-id]",
+                                "subscribe <topic>", "unsubscribe <topic>"
         in              (write) send prompt (non-blocking, validates and returns immediately)
         out             (write) bot writes response summary (includes actual response + tool usage summary)
         log             (read)  streaming chat history (USER:/ASSISTANT: with --- separators, blocks like tail -f)
@@ -49,11 +89,14 @@ anvillm/
         alias           (r/w)   session alias
         backend         (read)  backend name (e.g., "kiro-cli", "claude", "ollama")
         context         (r/w)   text prepended to every prompt
+        inbox/ outbox/ completed/ deadletter/ threads/ attachments/
+                        (dir)   mailbox folders, as for user/
 
 Communication:
     All communication goes through mailboxes (outbox -> inbox).
     "user" is a special participant (not a session).
     bot -> user: bot writes to its outbox with to="user"
+    pub/sub: to="topic:{name}" delivers a copy to every subscriber's inbox
     user -> bot: user writes to user/outbox with to="{session-id}"
     When processing user inbox, message body is written to sender's log file.
 */
@@ -70,24 +113,44 @@ const (
 	qidList
 	qidStatus
 	qidEvents                    // anvillm/events
+	qidEventsDir                 // anvillm/events.d directory
+	qidEventsAll                 // events.d/all
+	qidEventsSince               // events.d/since directory
+	qidEventsType                // events.d/type directory
+	qidEventsStats               // events.d/stats
+	qidEventsWebhooks            // events.d/webhooks
+	qidEventsSource              // events.d/source directory
 	qidUser                      // user directory
 	qidUserInbox                 // user/inbox
 	qidUserOutbox                // user/outbox
 	qidUserCompleted             // user/completed
 	qidUserCtl                   // user/ctl
 	qidUserMail                  // user/mail
+	qidUserThreads               // user/threads
+	qidUserDeadLetter            // user/deadletter
+	qidUserCall                  // user/call
+	qidMail                      // mail directory
+	qidMailQuery                 // mail/query
+	qidTopics                    // topics directory
+	qidTypes                     // types directory
 	qidTools                     // tools directory
 	qidSkills                    // skills directory
 	qidRoles                     // roles directory
-	qidSessionBase   = 1000
-	qidPeersBase     = 0x10000000 // peers/{id}/file
-	qidInboxBase     = 0x20000000 // session/{id}/inbox
-	qidOutboxBase    = 0x30000000 // session/{id}/outbox
-	qidCompletedBase = 0x40000000 // session/{id}/completed
-	qidMessageBase   = 0x50000000 // message files
-	qidToolsBase     = 0x70000000 // tools/{tool}
-	qidSkillsBase    = 0x80000000 // skills/{skill}
-	qidRolesBase     = 0x90000000 // roles/{role}
+	qidSessionBase    = 1000
+	qidPeersBase      = 0x10000000 // peers/{id}/file
+	qidInboxBase      = 0x20000000 // session/{id}/inbox
+	qidOutboxBase     = 0x30000000 // session/{id}/outbox
+	qidCompletedBase  = 0x40000000 // session/{id}/completed
+	qidMessageBase    = 0x50000000 // message files
+	qidToolsBase      = 0x70000000 // tools/{tool}
+	qidSkillsBase     = 0x80000000 // skills/{skill}
+	qidRolesBase      = 0x90000000 // roles/{role}
+	qidThreadsBase    = 0xA0000000 // {participant}/threads and threads/{thread-id}
+	qidDeadLetterBase = 0xB0000000 // session/{id}/deadletter
+	qidTopicsBase     = 0xC0000000 // topics/{topic}
+	qidTypesBase      = 0xD0000000 // types/{type}
+	qidAttachBase     = 0xE0000000 // {participant}/attachments/{msg-id}/{name}
+	qidEventsBase     = 0xF0000000 // events.d/{since,type,source}/{name}
 )
 
 // File indices within a session directory
@@ -110,7 +173,7 @@ const (
 var fileNames = []string{"ctl", "state", "pid", "cwd", "alias", "backend", "context", "sandbox", "tmux", "mail", "model", "role"}
 
 // Directory names in session
-var dirNames = []string{"inbox", "outbox", "completed"}
+var dirNames = []string{"inbox", "outbox", "completed", "deadletter", "threads", "attachments"}
 
 // Server implements a 9P file server for agent session management.
 // It exposes sessions, beads, tools, skills, and events through a virtual filesystem.
@@ -124,12 +187,25 @@ type Server struct {
 	roles         *RolesFS
 	OnAliasChange func(backend.Session) // Called when session alias changes
 	mu            sync.RWMutex
+
+	archive  *maildir.Writer     // mail archive searched by mail/query
+	webhooks *webhook.Dispatcher // reported by events.d/webhooks
 }
 
 type connState struct {
 	fids      map[uint32]*fid
 	mu        sync.RWMutex
 	sessionID string // Track which session owns this connection
+
+	conn io.Writer
+	wmu  sync.Mutex // serializes replies, some of which are sent from other goroutines
+}
+
+// reply writes a response to the connection
+func (cs *connState) reply(rfc *plan9.Fcall) error {
+	cs.wmu.Lock()
+	defer cs.wmu.Unlock()
+	return plan9.WriteFcall(cs.conn, rfc)
 }
 
 type fid struct {
@@ -141,9 +217,17 @@ type fid struct {
 	// The 9P client splits writes larger than msize into multiple Twrite messages
 	// with increasing offsets; we reassemble them here and process on Tclunk.
 	writeBuf []byte
-	// For streaming /events endpoint
-	eventCh    <-chan *eventbus.Event
-	eventUnsub func()
+	// For the event streams under /events
+	eventSub *eventbus.Subscription
+	// For events.d/since/{seq}: events are read from the journal; eventSub
+	// only signals that more were appended
+	journal *eventbus.JournalReader
+	// For live event streams: events left over from a replaced
+	// subscription, and the sequence number of the last event served
+	eventQueue []*eventbus.Event
+	eventSeq   uint64
+	// For /user/call and /mail/query: the unread remainder of the last reply
+	reply []byte
 }
 
 // NewServer creates and starts the 9P server.
@@ -233,17 +317,14 @@ func (s *Server) acceptLoop() {
 
 func (s *Server) serve(conn net.Conn) {
 	defer conn.Close()
-	cs := &connState{fids: make(map[uint32]*fid)}
+	cs := &connState{fids: make(map[uint32]*fid), conn: conn}
 
 	// Cancel any outstanding event subscriptions when the connection drops.
 	defer func() {
 		cs.mu.Lock()
 		defer cs.mu.Unlock()
 		for _, f := range cs.fids {
-			if f.eventUnsub != nil {
-				f.eventUnsub()
-				f.eventUnsub = nil
-			}
+			f.closeEvents()
 		}
 	}()
 
@@ -257,13 +338,18 @@ func (s *Server) serve(conn net.Conn) {
 		}
 
 		rfc := s.handle(cs, fc)
-		if err := plan9.WriteFcall(conn, rfc); err != nil {
+		if rfc == nil {
+			continue // answered later from another goroutine
+		}
+		if err := cs.reply(rfc); err != nil {
 			logging.Logger().Error("write error", zap.Error(err))
 			return
 		}
 	}
 }
 
+// handle answers a request. It returns nil for requests that are answered
+// later with cs.reply, so that they do not hold up the connection.
 func (s *Server) handle(cs *connState, fc *plan9.Fcall) *plan9.Fcall {
 	switch fc.Type {
 	case plan9.Tversion:
@@ -294,10 +380,9 @@ func (s *Server) handle(cs *connState, fc *plan9.Fcall) *plan9.Fcall {
 	case plan9.Tclunk:
 		cs.mu.Lock()
 		f, hasFid := cs.fids[fc.Fid]
-		if hasFid && f.eventUnsub != nil {
+		if hasFid {
 			// Cancel event subscription before dropping the fid.
-			f.eventUnsub()
-			f.eventUnsub = nil
+			f.closeEvents()
 		}
 		delete(cs.fids, fc.Fid)
 		cs.mu.Unlock()
@@ -353,6 +438,9 @@ func (s *Server) walk(cs *connState, fc *plan9.Fcall) *plan9.Fcall {
 			case "events":
 				qid = plan9.Qid{Type: QTFile, Path: qidEvents}
 				newPath = "/events"
+			case "events.d":
+				qid = plan9.Qid{Type: QTDir, Path: qidEventsDir}
+				newPath = "/events.d"
 			case "user":
 				qid = plan9.Qid{Type: QTDir, Path: qidUser}
 				newPath = "/user"
@@ -365,6 +453,15 @@ func (s *Server) walk(cs *connState, fc *plan9.Fcall) *plan9.Fcall {
 			case "roles":
 				qid = plan9.Qid{Type: QTDir, Path: qidRoles}
 				newPath = "/roles"
+			case "topics":
+				qid = plan9.Qid{Type: QTDir, Path: qidTopics}
+				newPath = "/topics"
+			case "types":
+				qid = plan9.Qid{Type: QTDir, Path: qidTypes}
+				newPath = "/types"
+			case "mail":
+				qid = plan9.Qid{Type: QTDir, Path: qidMail}
+				newPath = "/mail"
 			default:
 				// Check if it's a session ID
 				if sess := s.mgr.Get(name); sess != nil {
@@ -392,6 +489,18 @@ func (s *Server) walk(cs *connState, fc *plan9.Fcall) *plan9.Fcall {
 			case "mail":
 				qid = plan9.Qid{Type: QTFile, Path: qidUserMail}
 				newPath = "/user/mail"
+			case "deadletter":
+				qid = plan9.Qid{Type: QTDir, Path: qidUserDeadLetter}
+				newPath = "/user/deadletter"
+			case "threads":
+				qid = plan9.Qid{Type: QTDir, Path: qidUserThreads}
+				newPath = "/user/threads"
+			case "call":
+				qid = plan9.Qid{Type: QTFile, Path: qidUserCall}
+				newPath = "/user/call"
+			case "attachments":
+				qid = plan9.Qid{Type: QTDir, Path: qidAttachBase + hashID("user")}
+				newPath = "/user/attachments"
 			default:
 				return errFcall(fc, "not found")
 			}
@@ -452,6 +561,102 @@ func (s *Server) walk(cs *connState, fc *plan9.Fcall) *plan9.Fcall {
 			} else {
 				return errFcall(fc, "not found")
 			}
+		} else if path == "/topics" {
+			// Flat topic files, one per topic with subscribers
+			if len(s.mgr.GetMailManager().Subscribers(name)) == 0 {
+				return errFcall(fc, "not found")
+			}
+			qid = plan9.Qid{Type: QTFile, Path: qidTopicsBase + hashID(name)}
+			newPath = "/topics/" + name
+		} else if path == "/events.d" {
+			switch name {
+			case "all":
+				qid = plan9.Qid{Type: QTFile, Path: qidEventsAll}
+				newPath = "/events.d/all"
+			case "since":
+				qid = plan9.Qid{Type: QTDir, Path: qidEventsSince}
+				newPath = "/events.d/since"
+			case "stats":
+				qid = plan9.Qid{Type: QTFile, Path: qidEventsStats}
+				newPath = "/events.d/stats"
+			case "webhooks":
+				qid = plan9.Qid{Type: QTFile, Path: qidEventsWebhooks}
+				newPath = "/events.d/webhooks"
+			case "type":
+				qid = plan9.Qid{Type: QTDir, Path: qidEventsType}
+				newPath = "/events.d/type"
+			case "source":
+				qid = plan9.Qid{Type: QTDir, Path: qidEventsSource}
+				newPath = "/events.d/source"
+			default:
+				return errFcall(fc, "not found")
+			}
+		} else if path == "/events.d/since" || path == "/events.d/type" || path == "/events.d/source" {
+			// Any sequence number, type or source can be walked to; the
+			// directories list none
+			if path == "/events.d/since" {
+				if _, err := strconv.ParseUint(name, 10, 64); err != nil {
+					return errFcall(fc, "not found")
+				}
+			}
+			newPath = path + "/" + name
+			qid = plan9.Qid{Type: QTFile, Path: qidEventsBase + hashID(newPath)}
+		} else if path == "/mail" {
+			if name != "query" {
+				return errFcall(fc, "not found")
+			}
+			qid = plan9.Qid{Type: QTFile, Path: qidMailQuery}
+			newPath = "/mail/query"
+		} else if path == "/types" {
+			// Flat message type files, one per registered type
+			if _, ok := mailbox.LookupType(name); !ok {
+				return errFcall(fc, "not found")
+			}
+			qid = plan9.Qid{Type: QTFile, Path: qidTypesBase + hashID(name)}
+			newPath = "/types/" + name
+		} else if owner, msgID, file, ok := attachmentsPath(path); ok {
+			// Inside attachments/ (message dirs) or attachments/{msg-id}/ (files)
+			if owner != "user" && s.mgr.Get(owner) == nil {
+				return errFcall(fc, "session not found")
+			}
+			if file != "" {
+				return errFcall(fc, "not found")
+			}
+			if msgID == "" {
+				if _, ok := s.attachments(owner, name); !ok && name != draftDir {
+					return errFcall(fc, "not found")
+				}
+				qid = plan9.Qid{Type: QTDir, Path: qidAttachBase + hashID(owner+"/"+name)}
+			} else if msgID == draftDir {
+				// Any name: writing the file stages it
+				if name == "" || name != filepath.Base(name) || name == "." || name == ".." {
+					return errFcall(fc, "not found")
+				}
+				qid = plan9.Qid{Type: QTFile, Path: qidAttachBase + hashID(owner+"/"+msgID+"/"+name)}
+			} else {
+				if !s.hasAttachment(owner, msgID, name) {
+					return errFcall(fc, "not found")
+				}
+				qid = plan9.Qid{Type: QTFile, Path: qidAttachBase + hashID(owner+"/"+msgID+"/"+name)}
+			}
+			newPath = path + "/" + name
+		} else if owner, threadID, file, ok := threadsPath(path); ok {
+			// Inside threads/ (thread dirs) or threads/{thread-id}/ (message files)
+			if owner != "user" && s.mgr.Get(owner) == nil {
+				return errFcall(fc, "session not found")
+			}
+			if file != "" {
+				return errFcall(fc, "not found")
+			}
+			if threadID == "" {
+				if !s.hasThread(owner, name) {
+					return errFcall(fc, "not found")
+				}
+				qid = plan9.Qid{Type: QTDir, Path: qidThreadsBase + hashID(owner+"/"+name)}
+			} else {
+				qid = plan9.Qid{Type: QTFile, Path: qidMessageBase + hashID(owner+"threads"+threadID+name)}
+			}
+			newPath = path + "/" + name
 		} else if strings.HasPrefix(path, "/user/") && strings.Count(path, "/") == 2 {
 			// Inside user mailbox directory - message files
 			qid = plan9.Qid{Type: QTFile, Path: qidMessageBase + hashID("user"+path[6:]+name)}
@@ -474,6 +679,15 @@ func (s *Server) walk(cs *connState, fc *plan9.Fcall) *plan9.Fcall {
 			case "completed":
 				qid = plan9.Qid{Type: QTDir, Path: qidCompletedBase + hashID(sessID)}
 				newPath = path + "/completed"
+			case "deadletter":
+				qid = plan9.Qid{Type: QTDir, Path: qidDeadLetterBase + hashID(sessID)}
+				newPath = path + "/deadletter"
+			case "threads":
+				qid = plan9.Qid{Type: QTDir, Path: qidThreadsBase + hashID(sessID)}
+				newPath = path + "/threads"
+			case "attachments":
+				qid = plan9.Qid{Type: QTDir, Path: qidAttachBase + hashID(sessID)}
+				newPath = path + "/attachments"
 			default:
 				// Regular session file
 				idx := fileIndex(name)
@@ -522,11 +736,12 @@ func (s *Server) open(cs *connState, fc *plan9.Fcall) *plan9.Fcall {
 	f.mode = fc.Mode
 	f.offset = 0
 
-	// For the /events streaming endpoint, subscribe to the event bus.
-	if f.path == "/events" {
-		ch, cancel := s.events.Subscribe()
-		f.eventCh = ch
-		f.eventUnsub = cancel
+	// For the event streams, subscribe to the event bus.
+	if filter, since, ok := eventsView(f.path); ok {
+		if err := s.openEvents(f, filter, since); err != nil {
+			cs.mu.Unlock()
+			return errFcall(fc, err.Error())
+		}
 	}
 	qid := f.qid
 	cs.mu.Unlock()
@@ -534,8 +749,32 @@ func (s *Server) open(cs *connState, fc *plan9.Fcall) *plan9.Fcall {
 	return &plan9.Fcall{Type: plan9.Ropen, Tag: fc.Tag, Qid: qid}
 }
 
-func (s *Server) create(_ *connState, fc *plan9.Fcall) *plan9.Fcall {
-	return errFcall(fc, "create not supported")
+func (s *Server) create(cs *connState, fc *plan9.Fcall) *plan9.Fcall {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	f, ok := cs.fids[fc.Fid]
+	if !ok {
+		return errFcall(fc, "bad fid")
+	}
+	// Only draft attachments can be created (e.g. cp into the FUSE mount)
+	owner, msgID, file, ok := attachmentsPath(f.path)
+	if !ok || msgID != draftDir || file != "" || fc.Perm&plan9.DMDIR != 0 {
+		return errFcall(fc, "create not supported")
+	}
+	mailMgr := s.mgr.GetMailManager()
+	if mailMgr == nil {
+		return errFcall(fc, "mailbox not available")
+	}
+	if err := mailMgr.StageAttachment(owner, fc.Name, nil, attachmentLimits()); err != nil {
+		return errFcall(fc, err.Error())
+	}
+
+	f.path = f.path + "/" + fc.Name
+	f.qid = plan9.Qid{Type: QTFile, Path: qidAttachBase + hashID(owner+"/"+msgID+"/"+fc.Name)}
+	f.mode = fc.Mode
+	f.offset = 0
+	return &plan9.Fcall{Type: plan9.Rcreate, Tag: fc.Tag, Qid: f.qid}
 }
 
 func (s *Server) read(cs *connState, fc *plan9.Fcall) *plan9.Fcall {
@@ -546,27 +785,44 @@ func (s *Server) read(cs *connState, fc *plan9.Fcall) *plan9.Fcall {
 		return errFcall(fc, "bad fid")
 	}
 
-	// Streaming /events: block until next event arrives (or channel closed).
-	if f.eventCh != nil {
+	// Event streams block until the next event arrives (or EOF when the
+	// subscription is cancelled)
+	if f.eventSub != nil {
 		cs.mu.RUnlock()
-		e, ok := <-f.eventCh
-		if !ok {
-			// Channel closed (subscription cancelled); signal EOF.
-			return &plan9.Fcall{Type: plan9.Rread, Tag: fc.Tag, Count: 0}
-		}
-		data := eventbus.MarshalEvent(e)
-		return &plan9.Fcall{Type: plan9.Rread, Tag: fc.Tag, Count: uint32(len(data)), Data: data}
+		return readEvents(f, fc)
 	}
 
 	path := f.path
 	isDir := f.qid.Type&QTDir != 0
 	cs.mu.RUnlock()
 
+	switch path {
+	case "/user/call":
+		// A call waits for its response for up to minutes; the connection
+		// keeps serving other requests meanwhile
+		go func() {
+			if err := cs.reply(s.readReply(cs, f, fc, s.call)); err != nil {
+				logging.Logger().Warn("write error", zap.Error(err))
+			}
+		}()
+		return nil
+	case "/mail/query":
+		return s.readReply(cs, f, fc, s.query)
+	}
+	if owner, msgID, file, ok := attachmentsPath(path); ok && file != "" && !isDir {
+		return s.readAttachment(fc, owner, msgID, file)
+	}
+
 	var data []byte
 
 	if isDir {
 		data = s.readDir(path, fc.Offset, fc.Count)
 	} else {
+		// The first read of an inbox message marks it read. Do it before
+		// rendering so later chunks of the same file see the same read_at.
+		if fc.Offset == 0 {
+			s.markRead(path)
+		}
 		content := s.readFile(path)
 		if fc.Offset < uint64(len(content)) {
 			end := min(int(fc.Offset)+int(fc.Count), len(content))
@@ -577,6 +833,46 @@ func (s *Server) read(cs *connState, fc *plan9.Fcall) *plan9.Fcall {
 	return &plan9.Fcall{Type: plan9.Rread, Tag: fc.Tag, Count: uint32(len(data)), Data: data}
 }
 
+// markRead records a read of /{participant}/inbox/{msg-id}.json
+func (s *Server) markRead(path string) {
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(parts) != 3 || parts[1] != "inbox" || !strings.HasSuffix(parts[2], ".json") {
+		return
+	}
+	mailMgr := s.mgr.GetMailManager()
+	if mailMgr == nil {
+		return
+	}
+	mailMgr.MarkRead(parts[0], strings.TrimSuffix(parts[2], ".json"))
+}
+
+// readReply serves a read on a request/reply file (user/call, mail/query).
+// Any unread part of the previous reply is returned first; otherwise the
+// pending request is run and the read blocks until its reply. With nothing
+// written, the read is empty.
+func (s *Server) readReply(cs *connState, f *fid, fc *plan9.Fcall, run func([]byte) ([]byte, error)) *plan9.Fcall {
+	cs.mu.Lock()
+	if len(f.reply) == 0 && len(f.writeBuf) > 0 {
+		req := f.writeBuf
+		f.writeBuf = nil
+		cs.mu.Unlock()
+
+		reply, err := run(req)
+		if err != nil {
+			return errFcall(fc, err.Error())
+		}
+
+		cs.mu.Lock()
+		f.reply = reply
+	}
+	n := min(int(fc.Count), len(f.reply))
+	data := f.reply[:n]
+	f.reply = f.reply[n:]
+	cs.mu.Unlock()
+
+	return &plan9.Fcall{Type: plan9.Rread, Tag: fc.Tag, Count: uint32(n), Data: data}
+}
+
 func (s *Server) write(cs *connState, fc *plan9.Fcall) *plan9.Fcall {
 	cs.mu.Lock()
 	f, ok := cs.fids[fc.Fid]
@@ -584,6 +880,22 @@ func (s *Server) write(cs *connState, fc *plan9.Fcall) *plan9.Fcall {
 		cs.mu.Unlock()
 		return errFcall(fc, "bad fid")
 	}
+	// Event streams: a write sets the filter at once, for the reads after it
+	if f.eventSub != nil {
+		err := s.configureEvents(f, string(fc.Data))
+		cs.mu.Unlock()
+		if err != nil {
+			return errFcall(fc, err.Error())
+		}
+		return &plan9.Fcall{Type: plan9.Rwrite, Tag: fc.Tag, Count: uint32(len(fc.Data))}
+	}
+	// user/call, mail/query: the fid's offset also advances over replies
+	// read back, so requests are simply appended and run on the next read
+	if f.path == "/user/call" || f.path == "/mail/query" {
+		f.writeBuf = append(f.writeBuf, fc.Data...)
+		cs.mu.Unlock()
+		return &plan9.Fcall{Type: plan9.Rwrite, Tag: fc.Tag, Count: uint32(len(fc.Data))}
+	}
 	// Accumulate data into the per-fid write buffer at the given offset.
 	// The 9P client splits writes larger than msize into multiple Twrite messages
 	// with increasing offsets; we reassemble here and dispatch on Tclunk.
@@ -692,7 +1004,7 @@ func (s *Server) dispatchWrite(cs *connState, f *fid, tag uint16) *plan9.Fcall {
 		if parts[0] == "user" {
 			args := strings.Fields(input)
 			if len(args) == 0 {
-				return errFcall(fc, "usage: complete <msg-id> | delete <msg-id>")
+				return errFcall(fc, "usage: complete <msg-id> | delete <msg-id> | requeue <msg-id> [to] | purge [msg-id] | subscribe <topic> | unsubscribe <topic> | unpause <id> <id>")
 			}
 			switch args[0] {
 			case "complete":
@@ -713,6 +1025,22 @@ func (s *Server) dispatchWrite(cs *connState, f *fid, tag uint16) *plan9.Fcall {
 				if err := mailMgr.DeleteFromInbox("user", msgID); err != nil {
 					return errFcall(fc, err.Error())
 				}
+			case "requeue", "purge":
+				if err := s.deadLetterCtl("user", args); err != nil {
+					return errFcall(fc, err.Error())
+				}
+			case "subscribe", "unsubscribe":
+				if err := s.topicCtl("user", args); err != nil {
+					return errFcall(fc, err.Error())
+				}
+			case "unpause":
+				// Only the user can resume agents paused by the loop detector
+				if len(args) != 3 {
+					return errFcall(fc, "usage: unpause <id> <id>")
+				}
+				if err := s.mgr.Unpause(args[1], args[2]); err != nil {
+					return errFcall(fc, err.Error())
+				}
 			default:
 				return errFcall(fc, "unknown command")
 			}
@@ -725,7 +1053,7 @@ func (s *Server) dispatchWrite(cs *connState, f *fid, tag uint16) *plan9.Fcall {
 		}
 		args := strings.Fields(input)
 		if len(args) == 0 {
-			return errFcall(fc, "usage: stop | restart | kill | refresh | complete <msg-id>")
+			return errFcall(fc, "usage: stop | restart | kill | refresh | complete <msg-id> | requeue <msg-id> [to] | purge [msg-id] | subscribe <topic> | unsubscribe <topic>")
 		}
 		switch args[0] {
 		case "stop":
@@ -739,8 +1067,13 @@ func (s *Server) dispatchWrite(cs *connState, f *fid, tag uint16) *plan9.Fcall {
 				return errFcall(fc, err.Error())
 			}
 		case "kill":
+			meta := sess.Metadata()
 			sess.Close()
 			s.mgr.Remove(sess.ID())
+			s.events.Publish(sess.ID(), eventbus.EventSessionKilled, eventbus.SessionKilled{
+				Backend: meta.Backend,
+				Alias:   meta.Alias,
+			})
 		case "refresh":
 			ctx := context.Background()
 			if err := sess.Refresh(ctx); err != nil {
@@ -773,6 +1106,14 @@ func (s *Server) dispatchWrite(cs *connState, f *fid, tag uint16) *plan9.Fcall {
 			if err := mailMgr.CompleteMessage(parts[0], msgID); err != nil {
 				return errFcall(fc, err.Error())
 			}
+		case "requeue", "purge":
+			if err := s.deadLetterCtl(parts[0], args); err != nil {
+				return errFcall(fc, err.Error())
+			}
+		case "subscribe", "unsubscribe":
+			if err := s.topicCtl(parts[0], args); err != nil {
+				return errFcall(fc, err.Error())
+			}
 		default:
 			return errFcall(fc, "unknown command")
 		}
@@ -790,7 +1131,12 @@ func (s *Server) dispatchWrite(cs *connState, f *fid, tag uint16) *plan9.Fcall {
 		if !matched {
 			return errFcall(fc, "invalid alias: must match [A-Za-z0-9_-]+")
 		}
+		oldAlias := sess.Metadata().Alias
 		sess.SetAlias(input)
+		s.events.Publish(sess.ID(), eventbus.EventAliasChanged, eventbus.AliasChanged{
+			OldAlias: oldAlias,
+			NewAlias: input,
+		})
 		if s.OnAliasChange != nil {
 			s.OnAliasChange(sess)
 		}
@@ -805,6 +1151,7 @@ func (s *Server) dispatchWrite(cs *connState, f *fid, tag uint16) *plan9.Fcall {
 		}
 		if tmuxSess, ok := sess.(*tmux.Session); ok {
 			tmuxSess.SetContext(input)
+			s.events.Publish(sess.ID(), eventbus.EventContextChanged, eventbus.ContextChanged{Context: input})
 		}
 		return &plan9.Fcall{Type: plan9.Rwrite, Tag: fc.Tag, Count: uint32(len(fc.Data))}
 	}
@@ -824,7 +1171,12 @@ func (s *Server) dispatchWrite(cs *connState, f *fid, tag uint16) *plan9.Fcall {
 			return errFcall(fc, "role not found")
 		}
 		if tmuxSess, ok := sess.(*tmux.Session); ok {
+			oldRole := tmuxSess.GetRole()
 			tmuxSess.SetRole(input)
+			s.events.Publish(sessID, eventbus.EventRoleChanged, eventbus.RoleChanged{
+				OldRole: oldRole,
+				NewRole: input,
+			})
 		}
 		msg := mailbox.NewMessage("user", sessID, mailbox.MessageTypePromptRequest, "role: "+input, roleContent)
 		s.mgr.GetMailManager().DeliverToInbox(sessID, msg)
@@ -867,6 +1219,27 @@ func (s *Server) dispatchWrite(cs *connState, f *fid, tag uint16) *plan9.Fcall {
 		return &plan9.Fcall{Type: plan9.Rwrite, Tag: fc.Tag, Count: uint32(len(fc.Data))}
 	}
 
+	// /user/call - requests are sent when the fid is read; one written but
+	// never read back has nobody waiting for its response
+	if path == "/user/call" {
+		return errFcall(fc, "call: read the response from the same fid (e.g. 9p rdwr)")
+	}
+	if path == "/mail/query" {
+		return errFcall(fc, "query: read the results from the same fid (e.g. 9p rdwr)")
+	}
+
+	// /{id}/attachments/draft/{name} - stage a file for the next message
+	if owner, msgID, file, ok := attachmentsPath(path); ok && msgID == draftDir && file != "" {
+		mailMgr := s.mgr.GetMailManager()
+		if mailMgr == nil {
+			return errFcall(fc, "mailbox not available")
+		}
+		if err := mailMgr.StageAttachment(owner, file, f.writeBuf, attachmentLimits()); err != nil {
+			return errFcall(fc, err.Error())
+		}
+		return &plan9.Fcall{Type: plan9.Rwrite, Tag: fc.Tag, Count: uint32(len(fc.Data))}
+	}
+
 	// /{id}/mail or /user/mail - write message to outbox
 	if len(parts) == 2 && parts[1] == "mail" {
 		sessID := parts[0]
@@ -876,31 +1249,45 @@ func (s *Server) dispatchWrite(cs *connState, f *fid, tag uint16) *plan9.Fcall {
 		cs.sessionID = sessID
 		cs.mu.Unlock()
 
-		// Parse JSON message
-		msg, err := mailbox.FromJSON(f.writeBuf)
+		msg, to, err := s.parseMail(sessID, f.writeBuf)
 		if err != nil {
-			return errFcall(fc, fmt.Sprintf("invalid message JSON: %v", err))
-		}
-
-		// Validate message type
-		if err := mailbox.ValidateMessageType(msg.Type); err != nil {
 			return errFcall(fc, err.Error())
 		}
 
-		// Set from field
-		msg.From = sessID
-
-		// Generate UUID for message
-		msg.ID = uuid.New().String()
-
 		// Add to outbox
 		mailMgr := s.mgr.GetMailManager()
 		if mailMgr == nil {
 			return errFcall(fc, "mailbox not available")
 		}
 
-		if err := mailMgr.AddToOutbox(sessID, msg); err != nil {
-			return errFcall(fc, fmt.Sprintf("failed to add message: %v", err))
+		if len(to) == 1 && !session.IsBroadcast(to[0]) {
+			msg.To = to[0]
+			if err := mailMgr.AddToOutbox(sessID, msg); err != nil {
+				return errFcall(fc, fmt.Sprintf("failed to add message: %v", err))
+			}
+		} else {
+			// Multicast: one copy per recipient, sharing a correlation ID
+			recipients, err := s.mgr.ExpandRecipients(sessID, to)
+			if err != nil {
+				return errFcall(fc, err.Error())
+			}
+			var topics []string
+			for _, addr := range to {
+				if topic, ok := strings.CutPrefix(addr, mailbox.TopicPrefix); ok {
+					topics = append(topics, topic)
+				}
+			}
+			if len(topics) > 0 {
+				if msg.Metadata == nil {
+					msg.Metadata = make(map[string]interface{})
+				}
+				msg.Metadata["topic"] = strings.Join(topics, ",")
+			}
+			if len(recipients) > 0 {
+				if _, err := mailMgr.Multicast(sessID, msg, recipients); err != nil {
+					return errFcall(fc, fmt.Sprintf("failed to add message: %v", err))
+				}
+			}
 		}
 
 		// Transition sender to idle after sending (only for non-user sessions)
@@ -972,6 +1359,23 @@ func (s *Server) remove(cs *connState, fc *plan9.Fcall) *plan9.Fcall {
 		return &plan9.Fcall{Type: plan9.Rremove, Tag: fc.Tag}
 	}
 
+	// Discard a draft attachment
+	if owner, msgID, file, ok := attachmentsPath(path); ok && msgID == draftDir && file != "" {
+		mailMgr := s.mgr.GetMailManager()
+		if mailMgr == nil {
+			return errFcall(fc, "mailbox not available")
+		}
+		if err := mailMgr.DiscardDraft(owner, file); err != nil {
+			return errFcall(fc, err.Error())
+		}
+
+		cs.mu.Lock()
+		delete(cs.fids, fc.Fid)
+		cs.mu.Unlock()
+
+		return &plan9.Fcall{Type: plan9.Rremove, Tag: fc.Tag}
+	}
+
 	return errFcall(fc, "remove not supported for this file")
 }
 
@@ -992,9 +1396,13 @@ func (s *Server) readDir(path string, offset uint64, count uint32) []byte {
 			Uid: "q", Gid: "q", Muid: "q",
 		})
 		dirs = append(dirs, plan9.Dir{
-			Qid: plan9.Qid{Type: QTFile, Path: qidEvents}, Mode: 0644, Name: "events",
+			Qid: plan9.Qid{Type: QTFile, Path: qidEvents}, Mode: 0666, Name: "events",
 			Uid: "q", Gid: "q", Muid: "q",
 		})
+		dirs = append(dirs, plan9.Dir{
+			Qid:  plan9.Qid{Type: QTDir, Path: qidEventsDir},
+			Mode: plan9.DMDIR | 0555, Name: "events.d", Uid: "q", Gid: "q", Muid: "q",
+		})
 		dirs = append(dirs, plan9.Dir{
 			Qid:  plan9.Qid{Type: QTDir, Path: qidUser},
 			Mode: plan9.DMDIR | 0555, Name: "user", Uid: "q", Gid: "q", Muid: "q",
@@ -1011,6 +1419,18 @@ func (s *Server) readDir(path string, offset uint64, count uint32) []byte {
 			Qid:  plan9.Qid{Type: QTDir, Path: qidRoles},
 			Mode: plan9.DMDIR | 0555, Name: "roles", Uid: "q", Gid: "q", Muid: "q",
 		})
+		dirs = append(dirs, plan9.Dir{
+			Qid:  plan9.Qid{Type: QTDir, Path: qidTopics},
+			Mode: plan9.DMDIR | 0555, Name: "topics", Uid: "q", Gid: "q", Muid: "q",
+		})
+		dirs = append(dirs, plan9.Dir{
+			Qid:  plan9.Qid{Type: QTDir, Path: qidTypes},
+			Mode: plan9.DMDIR | 0555, Name: "types", Uid: "q", Gid: "q", Muid: "q",
+		})
+		dirs = append(dirs, plan9.Dir{
+			Qid:  plan9.Qid{Type: QTDir, Path: qidMail},
+			Mode: plan9.DMDIR | 0555, Name: "mail", Uid: "q", Gid: "q", Muid: "q",
+		})
 		for _, id := range s.mgr.List() {
 			dirs = append(dirs, plan9.Dir{
 				Qid:  plan9.Qid{Type: QTDir, Path: qidSessionBase + hashID(id)},
@@ -1050,6 +1470,59 @@ func (s *Server) readDir(path string, offset uint64, count uint32) []byte {
 				})
 			}
 		}
+	} else if path == "/topics" {
+		mailMgr := s.mgr.GetMailManager()
+		for _, topic := range mailMgr.Topics() {
+			content := s.readFile("/topics/" + topic)
+			dirs = append(dirs, plan9.Dir{
+				Qid:    plan9.Qid{Type: QTFile, Path: qidTopicsBase + hashID(topic)},
+				Mode:   0444,
+				Name:   topic,
+				Length: uint64(len(content)),
+				Uid:    "q", Gid: "q", Muid: "q",
+			})
+		}
+	} else if path == "/events.d" {
+		dirs = append(dirs, plan9.Dir{
+			Qid: plan9.Qid{Type: QTFile, Path: qidEventsAll}, Mode: 0666, Name: "all",
+			Uid: "q", Gid: "q", Muid: "q",
+		})
+		dirs = append(dirs, plan9.Dir{
+			Qid: plan9.Qid{Type: QTFile, Path: qidEventsStats}, Mode: 0444, Name: "stats",
+			Uid: "q", Gid: "q", Muid: "q",
+		})
+		dirs = append(dirs, plan9.Dir{
+			Qid: plan9.Qid{Type: QTFile, Path: qidEventsWebhooks}, Mode: 0444, Name: "webhooks",
+			Uid: "q", Gid: "q", Muid: "q",
+		})
+		dirs = append(dirs, plan9.Dir{
+			Qid:  plan9.Qid{Type: QTDir, Path: qidEventsSince},
+			Mode: plan9.DMDIR | 0555, Name: "since", Uid: "q", Gid: "q", Muid: "q",
+		})
+		dirs = append(dirs, plan9.Dir{
+			Qid:  plan9.Qid{Type: QTDir, Path: qidEventsType},
+			Mode: plan9.DMDIR | 0555, Name: "type", Uid: "q", Gid: "q", Muid: "q",
+		})
+		dirs = append(dirs, plan9.Dir{
+			Qid:  plan9.Qid{Type: QTDir, Path: qidEventsSource},
+			Mode: plan9.DMDIR | 0555, Name: "source", Uid: "q", Gid: "q", Muid: "q",
+		})
+	} else if path == "/mail" {
+		dirs = append(dirs, plan9.Dir{
+			Qid:  plan9.Qid{Type: QTFile, Path: qidMailQuery},
+			Mode: 0666, Name: "query", Uid: "q", Gid: "q", Muid: "q",
+		})
+	} else if path == "/types" {
+		for _, t := range mailbox.Types() {
+			content := s.readFile("/types/" + t.Name)
+			dirs = append(dirs, plan9.Dir{
+				Qid:    plan9.Qid{Type: QTFile, Path: qidTypesBase + hashID(t.Name)},
+				Mode:   0444,
+				Name:   t.Name,
+				Length: uint64(len(content)),
+				Uid:    "q", Gid: "q", Muid: "q",
+			})
+		}
 	} else if path == "/user" {
 		// User directory - only mailbox subdirs
 		dirs = append(dirs, plan9.Dir{
@@ -1072,6 +1545,83 @@ func (s *Server) readDir(path string, offset uint64, count uint32) []byte {
 			Qid:  plan9.Qid{Type: QTFile, Path: qidUserMail},
 			Mode: 0222, Name: "mail", Uid: "q", Gid: "q", Muid: "q",
 		})
+		dirs = append(dirs, plan9.Dir{
+			Qid:  plan9.Qid{Type: QTDir, Path: qidUserDeadLetter},
+			Mode: plan9.DMDIR | 0555, Name: "deadletter", Uid: "q", Gid: "q", Muid: "q",
+		})
+		dirs = append(dirs, plan9.Dir{
+			Qid:  plan9.Qid{Type: QTDir, Path: qidUserThreads},
+			Mode: plan9.DMDIR | 0555, Name: "threads", Uid: "q", Gid: "q", Muid: "q",
+		})
+		dirs = append(dirs, plan9.Dir{
+			Qid:  plan9.Qid{Type: QTFile, Path: qidUserCall},
+			Mode: 0666, Name: "call", Uid: "q", Gid: "q", Muid: "q",
+		})
+		dirs = append(dirs, plan9.Dir{
+			Qid:  plan9.Qid{Type: QTDir, Path: qidAttachBase + hashID("user")},
+			Mode: plan9.DMDIR | 0555, Name: "attachments", Uid: "q", Gid: "q", Muid: "q",
+		})
+	} else if owner, msgID, file, ok := attachmentsPath(path); ok {
+		// Attachment listing: attachments/ holds one dir per message with
+		// attachments, attachments/{msg-id}/ holds its files
+		mailMgr := s.mgr.GetMailManager()
+		if mailMgr == nil || file != "" {
+			return nil
+		}
+		if msgID == "" {
+			dirs = append(dirs, plan9.Dir{
+				Qid:  plan9.Qid{Type: QTDir, Path: qidAttachBase + hashID(owner+"/"+draftDir)},
+				Mode: plan9.DMDIR | 0777, Name: draftDir, Uid: "q", Gid: "q", Muid: "q",
+			})
+			for _, msg := range mailMgr.MessagesWithAttachments(owner) {
+				dirs = append(dirs, plan9.Dir{
+					Qid:  plan9.Qid{Type: QTDir, Path: qidAttachBase + hashID(owner+"/"+msg.ID)},
+					Mode: plan9.DMDIR | 0555, Name: msg.ID, Uid: "q", Gid: "q", Muid: "q",
+				})
+			}
+		} else {
+			attachments, _ := s.attachments(owner, msgID)
+			mode := plan9.Perm(0444)
+			if msgID == draftDir {
+				attachments, mode = mailMgr.Drafts(owner), 0666
+			}
+			for _, a := range attachments {
+				dirs = append(dirs, plan9.Dir{
+					Qid:    plan9.Qid{Type: QTFile, Path: qidAttachBase + hashID(owner+"/"+msgID+"/"+a.Name)},
+					Mode:   mode,
+					Name:   a.Name,
+					Length: uint64(a.Size),
+					Uid:    "q", Gid: "q", Muid: "q",
+				})
+			}
+		}
+	} else if owner, threadID, file, ok := threadsPath(path); ok {
+		// Thread listing: threads/ holds one dir per thread,
+		// threads/{thread-id}/ holds its messages in delivery order
+		mailMgr := s.mgr.GetMailManager()
+		if mailMgr == nil || file != "" {
+			return nil
+		}
+		if threadID == "" {
+			for _, id := range mailMgr.GetThreads(owner) {
+				dirs = append(dirs, plan9.Dir{
+					Qid:  plan9.Qid{Type: QTDir, Path: qidThreadsBase + hashID(owner+"/"+id)},
+					Mode: plan9.DMDIR | 0555, Name: id, Uid: "q", Gid: "q", Muid: "q",
+				})
+			}
+		} else {
+			messages, _ := mailMgr.GetThread(owner, threadID)
+			for _, msg := range messages {
+				data, _ := msg.ToJSON()
+				dirs = append(dirs, plan9.Dir{
+					Qid:    plan9.Qid{Type: QTFile, Path: qidMessageBase + hashID(owner+"threads"+threadID+msg.ID+".json")},
+					Mode:   0444,
+					Name:   msg.ID + ".json",
+					Length: uint64(len(data)),
+					Uid:    "q", Gid: "q", Muid: "q",
+				})
+			}
+		}
 	} else if strings.HasPrefix(path, "/user/") && strings.Count(path, "/") == 2 {
 		// User mailbox directory (inbox/outbox/completed)
 		mailboxType := strings.TrimPrefix(path, "/user/")
@@ -1086,12 +1636,17 @@ func (s *Server) readDir(path string, offset uint64, count uint32) []byte {
 				messages = mailMgr.GetOutbox("user")
 			case "completed":
 				messages = mailMgr.GetCompleted("user")
+			case "deadletter":
+				messages = mailMgr.GetDeadLetter("user")
 			}
 
-			// Sort messages by ID (which is now timestamp-based)
-			sort.Slice(messages, func(i, j int) bool {
-				return messages[i].ID < messages[j].ID
-			})
+			// Sort messages by ID (which is timestamp-based); the inbox is
+			// already in processing order (priority, then age)
+			if mailboxType != "inbox" {
+				sort.Slice(messages, func(i, j int) bool {
+					return messages[i].ID < messages[j].ID
+				})
+			}
 
 			for _, msg := range messages {
 				data, _ := msg.ToJSON()
@@ -1140,6 +1695,15 @@ func (s *Server) readDir(path string, offset uint64, count uint32) []byte {
 			case "outbox":
 				qidBase = qidOutboxBase
 				mode = 0555 // read-only (can list and read files)
+			case "deadletter":
+				qidBase = qidDeadLetterBase
+				mode = 0555 // read-only (can list and read files)
+			case "threads":
+				qidBase = qidThreadsBase
+				mode = 0555 // read-only (can list and read files)
+			case "attachments":
+				qidBase = qidAttachBase
+				mode = 0555 // read-only (can list and read files)
 			default:
 				qidBase = qidCompletedBase
 				mode = 0555 // read-only (can list and read files)
@@ -1169,12 +1733,17 @@ func (s *Server) readDir(path string, offset uint64, count uint32) []byte {
 			messages = mailMgr.GetOutbox(sessID)
 		case "completed":
 			messages = mailMgr.GetCompleted(sessID)
+		case "deadletter":
+			messages = mailMgr.GetDeadLetter(sessID)
 		}
 
-		// Sort messages by ID (which is now timestamp-based)
-		sort.Slice(messages, func(i, j int) bool {
-			return messages[i].ID < messages[j].ID
-		})
+		// Sort messages by ID (which is timestamp-based); the inbox is
+		// already in processing order (priority, then age)
+		if mailboxType != "inbox" {
+			sort.Slice(messages, func(i, j int) bool {
+				return messages[i].ID < messages[j].ID
+			})
+		}
 
 		for _, msg := range messages {
 			data, _ := msg.ToJSON()
@@ -1225,6 +1794,25 @@ func (s *Server) readFile(path string) string {
 		return ""
 	}
 
+	// Handle topic paths: subscribers, one per line
+	if topic, ok := strings.CutPrefix(path, "/topics/"); ok {
+		subs := s.mgr.GetMailManager().Subscribers(topic)
+		if len(subs) == 0 {
+			return ""
+		}
+		return strings.Join(subs, "\n") + "\n"
+	}
+
+	// Handle message type paths: definition as JSON
+	if name, ok := strings.CutPrefix(path, "/types/"); ok {
+		t, ok := mailbox.LookupType(name)
+		if !ok {
+			return ""
+		}
+		data, _ := json.MarshalIndent(t, "", "  ")
+		return string(data) + "\n"
+	}
+
 	// Handle roles paths
 	if strings.HasPrefix(path, "/roles/") {
 		if s.roles != nil {
@@ -1237,6 +1825,14 @@ func (s *Server) readFile(path string) string {
 		return ""
 	}
 
+	if path == "/events.d/stats" {
+		return s.eventStats()
+	}
+
+	if path == "/events.d/webhooks" {
+		return s.webhookStatus()
+	}
+
 	if path == "/list" {
 		var lines []string
 		for _, id := range s.mgr.List() {
@@ -1296,7 +1892,7 @@ func (s *Server) readFile(path string) string {
 	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
 
 	// User message file: /user/mailbox/msg-*.json
-	if len(parts) == 3 && parts[0] == "user" && (parts[1] == "inbox" || parts[1] == "outbox" || parts[1] == "completed") {
+	if len(parts) == 3 && parts[0] == "user" && isMailboxDir(parts[1]) {
 		msgFile := parts[2]
 		msgID := strings.TrimSuffix(msgFile, ".json")
 
@@ -1314,8 +1910,29 @@ func (s *Server) readFile(path string) string {
 		return string(data)
 	}
 
+	// Thread message file: /{user,sessID}/threads/{thread-id}/msg-*.json
+	if len(parts) == 4 && parts[1] == "threads" {
+		mailMgr := s.mgr.GetMailManager()
+		if mailMgr == nil {
+			return ""
+		}
+
+		messages, err := mailMgr.GetThread(parts[0], parts[2])
+		if err != nil {
+			return ""
+		}
+		msgID := strings.TrimSuffix(parts[3], ".json")
+		for _, msg := range messages {
+			if msg.ID == msgID {
+				data, _ := msg.ToJSON()
+				return string(data)
+			}
+		}
+		return ""
+	}
+
 	// Message file: /sessID/mailbox/msg-*.json
-	if len(parts) == 3 && (parts[1] == "inbox" || parts[1] == "outbox" || parts[1] == "completed") {
+	if len(parts) == 3 && isMailboxDir(parts[1]) {
 		sessID := parts[0]
 		_ = parts[1] // mailboxType (not used, just for validation)
 		msgFile := parts[2]
@@ -1391,6 +2008,209 @@ func (s *Server) getSessionFile(sess backend.Session, idx int) string {
 	return ""
 }
 
+// deadLetterCtl handles the dead-letter ctl verbs shared by user/ctl and
+// {id}/ctl: "requeue <msg-id> [to]" and "purge [msg-id]".
+func (s *Server) deadLetterCtl(participant string, args []string) error {
+	mailMgr := s.mgr.GetMailManager()
+	switch args[0] {
+	case "requeue":
+		if len(args) < 2 || len(args) > 3 {
+			return fmt.Errorf("usage: requeue <msg-id> [to]")
+		}
+		to := ""
+		if len(args) == 3 {
+			to = args[2]
+		}
+		return mailMgr.Requeue(participant, args[1], to)
+	default:
+		if len(args) > 2 {
+			return fmt.Errorf("usage: purge [msg-id]")
+		}
+		msgID := ""
+		if len(args) == 2 {
+			msgID = args[1]
+		}
+		_, err := mailMgr.PurgeDeadLetter(participant, msgID)
+		return err
+	}
+}
+
+// topicCtl handles "subscribe <topic>" and "unsubscribe <topic>" for
+// user/ctl and {id}/ctl.
+func (s *Server) topicCtl(participant string, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: %s <topic>", args[0])
+	}
+	mailMgr := s.mgr.GetMailManager()
+	if args[0] == "subscribe" {
+		return mailMgr.Subscribe(participant, args[1])
+	}
+	return mailMgr.Unsubscribe(participant, args[1])
+}
+
+// parseMail decodes and validates a message written by sessID to its mail
+// (or call) file. "to" may be a single address or an array; the addresses
+// are returned separately. Fields the mailbox owns are reset and inline
+// attachment contents are moved to the attachment store.
+func (s *Server) parseMail(sessID string, data []byte) (*mailbox.Message, []string, error) {
+	msg, to, err := mailbox.DecodeMail(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid message JSON: %v", err)
+	}
+
+	// Validate message type
+	if err := mailbox.ValidateMessageType(msg.Type); err != nil {
+		return nil, nil, err
+	}
+	if err := mailbox.ValidatePriority(msg.Priority); err != nil {
+		return nil, nil, err
+	}
+
+	// Validate body/metadata against the type's schemas (all violations
+	// are reported at once so the sender can fix them in one go)
+	if err := mailbox.ValidateSchema(msg); err != nil {
+		return nil, nil, err
+	}
+
+	// Set from field
+	msg.From = sessID
+
+	// Assign a fresh, time-sortable ID (client-supplied IDs are ignored)
+	msg.ID = mailbox.NewID()
+	msg.ThreadID = "" // assigned from in_reply_to on delivery
+
+	// Lifecycle and response tracking are recorded by the mailbox
+	msg.DeliveredAt, msg.ReadAt, msg.CompletedAt = 0, 0, 0
+	msg.RespondedAt, msg.ResponseID, msg.Overdue = 0, "", false
+	msg.Retries, msg.NextAttempt = 0, 0
+
+	mailMgr := s.mgr.GetMailManager()
+	if mailMgr == nil {
+		return nil, nil, fmt.Errorf("mailbox not available")
+	}
+	if err := mailMgr.StoreAttachments(msg, attachmentLimits()); err != nil {
+		return nil, nil, err
+	}
+	return msg, to, nil
+}
+
+// isMailboxDir reports whether name is one of the flat message folders
+func isMailboxDir(name string) bool {
+	switch name {
+	case "inbox", "outbox", "completed", "deadletter":
+		return true
+	}
+	return false
+}
+
+// threadsPath splits a path under a participant's threads/ directory into
+// its owner, thread ID and message file name (empty when the path is not
+// that deep). ok is false for any path outside threads/.
+func threadsPath(path string) (owner, threadID, file string, ok bool) {
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(parts) < 2 || len(parts) > 4 || parts[1] != "threads" {
+		return "", "", "", false
+	}
+	owner = parts[0]
+	if len(parts) > 2 {
+		threadID = parts[2]
+	}
+	if len(parts) > 3 {
+		file = parts[3]
+	}
+	return owner, threadID, file, true
+}
+
+// draftDir is the attachments/ subdirectory holding a participant's draft
+// attachments: files written there can be attached by name to the next
+// message it sends (see mailbox.StageAttachment)
+const draftDir = "draft"
+
+// attachmentLimits returns the configured caps on a message's attachments
+func attachmentLimits() mailbox.AttachmentLimits {
+	return mailbox.AttachmentLimits{
+		MaxSize:  config.MailAttachmentMaxSize,
+		MaxCount: config.MailAttachmentMaxCount,
+		MaxTotal: config.MailAttachmentMaxTotal,
+	}
+}
+
+// attachmentsPath splits a path under a participant's attachments/
+// directory into its owner, message ID and attachment name (empty when the
+// path is not that deep). ok is false for any path outside attachments/.
+func attachmentsPath(path string) (owner, msgID, name string, ok bool) {
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(parts) < 2 || len(parts) > 4 || parts[1] != "attachments" {
+		return "", "", "", false
+	}
+	owner = parts[0]
+	if len(parts) > 2 {
+		msgID = parts[2]
+	}
+	if len(parts) > 3 {
+		name = parts[3]
+	}
+	return owner, msgID, name, true
+}
+
+// attachments returns the attachments of a message in one of a
+// participant's folders; ok is false if it has none
+func (s *Server) attachments(participant, msgID string) ([]mailbox.Attachment, bool) {
+	mailMgr := s.mgr.GetMailManager()
+	if mailMgr == nil {
+		return nil, false
+	}
+	msg, err := mailMgr.GetMessage(participant, msgID)
+	if err != nil || len(msg.Attachments) == 0 {
+		return nil, false
+	}
+	return msg.Attachments, true
+}
+
+// hasAttachment reports whether a participant's message has the named attachment
+func (s *Server) hasAttachment(participant, msgID, name string) bool {
+	attachments, _ := s.attachments(participant, msgID)
+	for _, a := range attachments {
+		if a.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// readAttachment serves a read of an attachment file straight from the
+// attachment store, so large files are not loaded whole for every chunk
+func (s *Server) readAttachment(fc *plan9.Fcall, participant, msgID, name string) *plan9.Fcall {
+	var f *os.File
+	var err error
+	if msgID == draftDir {
+		f, err = s.mgr.GetMailManager().OpenDraft(participant, name)
+	} else {
+		f, err = s.mgr.GetMailManager().OpenAttachment(participant, msgID, name)
+	}
+	if err != nil {
+		return errFcall(fc, err.Error())
+	}
+	defer f.Close()
+
+	buf := make([]byte, fc.Count)
+	n, err := f.ReadAt(buf, int64(fc.Offset))
+	if err != nil && err != io.EOF {
+		return errFcall(fc, err.Error())
+	}
+	return &plan9.Fcall{Type: plan9.Rread, Tag: fc.Tag, Count: uint32(n), Data: buf[:n]}
+}
+
+// hasThread reports whether participant took part in the given thread
+func (s *Server) hasThread(participant, threadID string) bool {
+	mailMgr := s.mgr.GetMailManager()
+	if mailMgr == nil {
+		return false
+	}
+	_, err := mailMgr.GetThread(participant, threadID)
+	return err == nil
+}
+
 func (s *Server) pathToDir(path string, qid plan9.Qid) plan9.Dir {
 	name := filepath.Base(path)
 	if path == "/" {
@@ -0,0 +1,45 @@
+package p9
+
+import (
+	"anvillm/internal/webhook"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SetWebhooks sets the webhook dispatcher whose deliveries events.d/webhooks
+// reports
+func (s *Server) SetWebhooks(d *webhook.Dispatcher) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.webhooks = d
+}
+
+// webhookStatus formats events.d/webhooks: one line per webhook with its
+// name, queued, delivered, failed and retry counts, last event seq, last
+// attempt (RFC 3339, "-" if none), URL and the result of the last attempt
+func (s *Server) webhookStatus() string {
+	s.mu.RLock()
+	d := s.webhooks
+	s.mu.RUnlock()
+	if d == nil {
+		return ""
+	}
+
+	var lines []string
+	for _, st := range d.Status() {
+		lastAt, result := "-", st.LastResult
+		if !st.LastAt.IsZero() {
+			lastAt = st.LastAt.Format(time.RFC3339)
+		}
+		if result == "" {
+			result = "-"
+		}
+		lines = append(lines, fmt.Sprintf("%s\t%d\t%d\t%d\t%d\t%d\t%s\t%s\t%s",
+			st.Name, st.Queued, st.Delivered, st.Failed, st.Retries, st.LastSeq, lastAt, st.URL, result))
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
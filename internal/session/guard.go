@@ -0,0 +1,151 @@
+package session
+
+import (
+	"anvillm/internal/config"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// mailGuard throttles mail between agents. It enforces a per-pair rate limit
+// (config.MailRateLimit per config.MailRateWindow, per direction) and detects
+// loops: two agents exchanging more than config.MailLoopThreshold messages
+// within config.MailLoopWindow without the user writing to either of them.
+// A looping pair is paused until the user unpauses it. Messages held back
+// stay in the sender's outbox. State is in-memory only; times older than
+// their window are evicted on each delivery and a killed session's entries
+// are dropped (see forget).
+type mailGuard struct {
+	mu        sync.Mutex
+	sent      map[[2]string][]time.Time // sender -> recipient delivery times
+	exchanged map[[2]string][]time.Time // pair delivery times since the user last wrote to either
+	paused    map[[2]string]bool
+}
+
+func newMailGuard() *mailGuard {
+	return &mailGuard{
+		sent:      make(map[[2]string][]time.Time),
+		exchanged: make(map[[2]string][]time.Time),
+		paused:    make(map[[2]string]bool),
+	}
+}
+
+// pairKey identifies an unordered pair of participants
+func pairKey(a, b string) [2]string {
+	if a > b {
+		a, b = b, a
+	}
+	return [2]string{a, b}
+}
+
+// since drops the times before cutoff
+func since(times []time.Time, cutoff time.Time) []time.Time {
+	i := sort.Search(len(times), func(i int) bool { return !times[i].Before(cutoff) })
+	return times[i:]
+}
+
+// allow reports whether a message from sender to recipient may be delivered
+// now. The user is never held back.
+func (g *mailGuard) allow(sender, recipient string, now time.Time) bool {
+	if sender == "user" {
+		return true
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.paused[pairKey(sender, recipient)] {
+		return false
+	}
+	if config.MailRateLimit <= 0 {
+		return true
+	}
+	key := [2]string{sender, recipient}
+	g.sent[key] = since(g.sent[key], now.Add(-config.MailRateWindow))
+	return len(g.sent[key]) < config.MailRateLimit
+}
+
+// record notes a delivery. If it trips the loop detector the pair is paused
+// and the number of messages exchanged is returned; otherwise 0.
+func (g *mailGuard) record(sender, recipient string, now time.Time) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if sender == "user" {
+		// User involvement: conversations with the recipient are not loops
+		for key := range g.exchanged {
+			if key[0] == recipient || key[1] == recipient {
+				delete(g.exchanged, key)
+			}
+		}
+		return 0
+	}
+	g.evictLocked(now)
+	key := [2]string{sender, recipient}
+	g.sent[key] = append(g.sent[key], now)
+
+	if recipient == "user" || config.MailLoopThreshold <= 0 {
+		return 0
+	}
+	pair := pairKey(sender, recipient)
+	times := append(since(g.exchanged[pair], now.Add(-config.MailLoopWindow)), now)
+	if len(times) <= config.MailLoopThreshold {
+		g.exchanged[pair] = times
+		return 0
+	}
+	delete(g.exchanged, pair)
+	g.paused[pair] = true
+	return len(times)
+}
+
+// unpause resumes delivery between a and b
+func (g *mailGuard) unpause(a, b string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	pair := pairKey(a, b)
+	if !g.paused[pair] {
+		return fmt.Errorf("mail between %s and %s is not paused", a, b)
+	}
+	delete(g.paused, pair)
+	return nil
+}
+
+// evictLocked drops the times that fell out of their window, and the pairs
+// left without any. Caller must hold g.mu.
+func (g *mailGuard) evictLocked(now time.Time) {
+	for key, times := range g.sent {
+		if times = since(times, now.Add(-config.MailRateWindow)); len(times) == 0 {
+			delete(g.sent, key)
+		} else {
+			g.sent[key] = times
+		}
+	}
+	for key, times := range g.exchanged {
+		if times = since(times, now.Add(-config.MailLoopWindow)); len(times) == 0 {
+			delete(g.exchanged, key)
+		} else {
+			g.exchanged[key] = times
+		}
+	}
+}
+
+// forget drops every entry involving a participant, e.g. when its session
+// is killed
+func (g *mailGuard) forget(participant string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, m := range []map[[2]string][]time.Time{g.sent, g.exchanged} {
+		for key := range m {
+			if key[0] == participant || key[1] == participant {
+				delete(m, key)
+			}
+		}
+	}
+	for key := range g.paused {
+		if key[0] == participant || key[1] == participant {
+			delete(g.paused, key)
+		}
+	}
+}
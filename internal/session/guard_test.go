@@ -0,0 +1,132 @@
+package session
+
+import (
+	"anvillm/internal/config"
+	"testing"
+	"time"
+)
+
+// guardConfig sets the guard limits for one test
+func guardConfig(t *testing.T, rate int, rateWindow time.Duration, loop int, loopWindow time.Duration) {
+	rate0, rateWindow0 := config.MailRateLimit, config.MailRateWindow
+	loop0, loopWindow0 := config.MailLoopThreshold, config.MailLoopWindow
+	t.Cleanup(func() {
+		config.MailRateLimit, config.MailRateWindow = rate0, rateWindow0
+		config.MailLoopThreshold, config.MailLoopWindow = loop0, loopWindow0
+	})
+	config.MailRateLimit, config.MailRateWindow = rate, rateWindow
+	config.MailLoopThreshold, config.MailLoopWindow = loop, loopWindow
+}
+
+func TestGuardRateLimit(t *testing.T) {
+	guardConfig(t, 2, time.Minute, 0, 0)
+	g := newMailGuard()
+	t0 := time.Now()
+
+	steps := []struct {
+		from, to string
+		at       time.Duration
+		allowed  bool
+	}{
+		{"a", "b", 0, true},
+		{"a", "b", time.Second, true},
+		{"a", "b", 2 * time.Second, false}, // limit reached
+		{"b", "a", 2 * time.Second, true},  // the other direction is counted apart
+		{"a", "c", 2 * time.Second, true},
+		{"user", "b", 2 * time.Second, true},
+		{"a", "b", time.Minute + time.Second, true}, // the first fell out of the window
+		{"a", "b", time.Minute + time.Second, false},
+	}
+	for i, s := range steps {
+		now := t0.Add(s.at)
+		if got := g.allow(s.from, s.to, now); got != s.allowed {
+			t.Fatalf("step %d: %s -> %s allowed = %v, want %v", i, s.from, s.to, got, s.allowed)
+		}
+		if s.allowed {
+			g.record(s.from, s.to, now)
+		}
+	}
+}
+
+func TestGuardLoop(t *testing.T) {
+	guardConfig(t, 0, time.Minute, 3, 10*time.Minute)
+	g := newMailGuard()
+	t0 := time.Now()
+
+	// Three exchanges are fine, the fourth trips the detector
+	for i, from := range []string{"a", "b", "a"} {
+		to := map[string]string{"a": "b", "b": "a"}[from]
+		if n := g.record(from, to, t0.Add(time.Duration(i)*time.Second)); n != 0 {
+			t.Fatalf("message %d: loop detected (%d)", i+1, n)
+		}
+	}
+	if n := g.record("b", "a", t0.Add(3*time.Second)); n != 4 {
+		t.Fatalf("got %d, want the loop detected at 4 messages", n)
+	}
+	for _, dir := range [][2]string{{"a", "b"}, {"b", "a"}} {
+		if g.allow(dir[0], dir[1], t0.Add(4*time.Second)) {
+			t.Errorf("%s -> %s allowed while paused", dir[0], dir[1])
+		}
+	}
+	if !g.allow("a", "c", t0.Add(4*time.Second)) || !g.allow("user", "a", t0.Add(4*time.Second)) {
+		t.Error("pause held back other pairs")
+	}
+
+	if err := g.unpause("b", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.unpause("a", "b"); err == nil {
+		t.Error("unpausing twice succeeded")
+	}
+	if !g.allow("a", "b", t0.Add(5*time.Second)) {
+		t.Error("still paused after unpause")
+	}
+}
+
+func TestGuardLoopReset(t *testing.T) {
+	tests := []struct {
+		name      string
+		userWrote bool          // the user writes to one of them in between
+		later     time.Duration // when the third message is sent
+		looped    bool
+	}{
+		{name: "no reset", looped: true},
+		{name: "user writes to one of them", userWrote: true},
+		{name: "window passes", later: 11 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guardConfig(t, 0, time.Minute, 2, 10*time.Minute)
+			g := newMailGuard()
+			now := time.Now()
+			g.record("a", "b", now)
+			g.record("b", "a", now)
+			if tt.userWrote {
+				g.record("user", "b", now)
+			}
+			if n := g.record("a", "b", now.Add(tt.later)); (n != 0) != tt.looped {
+				t.Errorf("loop detected = %v, want %v", n != 0, tt.looped)
+			}
+		})
+	}
+}
+
+func TestGuardEvictAndForget(t *testing.T) {
+	guardConfig(t, 10, time.Minute, 10, 10*time.Minute)
+	g := newMailGuard()
+	t0 := time.Now()
+	g.record("a", "b", t0)
+	g.record("c", "d", t0)
+
+	// A delivery an hour later evicts everything older than the windows
+	g.record("a", "c", t0.Add(time.Hour))
+	if len(g.sent) != 1 || len(g.exchanged) != 1 {
+		t.Errorf("after evict: %d senders, %d pairs; want 1 and 1", len(g.sent), len(g.exchanged))
+	}
+
+	g.paused[pairKey("a", "d")] = true
+	g.forget("a")
+	if len(g.sent) != 0 || len(g.exchanged) != 0 || len(g.paused) != 0 {
+		t.Errorf("after forget: %v %v %v", g.sent, g.exchanged, g.paused)
+	}
+}
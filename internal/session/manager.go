@@ -4,11 +4,15 @@ package session
 import (
 	"anvillm/internal/backend"
 	"anvillm/internal/backend/tmux"
+	"anvillm/internal/config"
 	"anvillm/internal/eventbus"
 	"anvillm/pkg/logging"
 	"anvillm/internal/mailbox"
 	"context"
+	"errors"
+	"fmt"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -21,10 +25,19 @@ type Manager struct {
 	sessions      map[string]backend.Session
 	mailManager   *mailbox.Manager
 	eventBus      *eventbus.Bus
+	registry      *Registry
+	saveMu        sync.Mutex // serializes registry saves, snapshot to write
+	records       map[string]tmux.Snapshot // persisted sessions awaiting recovery
 	OnStateChange func(sessionID, oldState, newState string)
 	mu            sync.RWMutex
 	stopCh        chan struct{}
+	wakeCh        chan struct{}
+	guard         *mailGuard
 	wg            sync.WaitGroup
+
+	// SelectionPolicy picks the recipient of role: and cwd: addresses
+	// (default LongestIdle)
+	SelectionPolicy SelectionPolicy
 }
 
 // NewManager creates a session manager with the given backends
@@ -37,6 +50,10 @@ func NewManager(backends map[string]backend.Backend) *Manager {
 		mailManager: mailMgr,
 		eventBus:    nil, // Set via SetEventBus
 		stopCh:      make(chan struct{}),
+		wakeCh:      make(chan struct{}, 1),
+		guard:       newMailGuard(),
+
+		SelectionPolicy: LongestIdle,
 	}
 
 	// Set session getter for alias lookup
@@ -71,8 +88,40 @@ func NewManager(backends map[string]backend.Backend) *Manager {
 				}
 				m.eventBus.Publish(receiverID, evType, msg)
 			}
+			m.publishMessageEvent(eventbus.EventMessageDelivered, receiverID, msg)
+			if receiverID != "user" && msg.HighPriority() {
+				m.wake()
+			}
+		},
+	)
+	mailMgr.SetLifecycleCallbacks(
+		func(participant string, msg *mailbox.Message) {
+			m.publishMessageEvent(eventbus.EventMessageRead, participant, msg)
+		},
+		func(participant string, msg *mailbox.Message) {
+			m.publishMessageEvent(eventbus.EventMessageCompleted, participant, msg)
 		},
 	)
+	mailMgr.SetDeleteCallback(func(participant string, msg *mailbox.Message) {
+		m.publishMessageEvent(eventbus.EventMessageDeleted, participant, msg)
+	})
+	mailMgr.SetResponseCallback(func(request, response *mailbox.Message) {
+		if m.eventBus != nil {
+			m.eventBus.Publish(request.From, eventbus.EventResponseReceived, map[string]any{
+				"id":           request.ID,
+				"response_id":  response.ID,
+				"from":         response.From,
+				"type":         response.Type,
+				"subject":      response.Subject,
+				"responded_at": request.RespondedAt,
+			})
+		}
+	})
+	mailMgr.SetQueueCallback(func(senderID string, msg *mailbox.Message) {
+		if msg.HighPriority() {
+			m.wake()
+		}
+	})
 	
 	// Start mail processing loop
 	m.wg.Add(1)
@@ -96,16 +145,21 @@ func (m *Manager) New(opts backend.SessionOptions, backendName string) (backend.
 	sess, err := b.CreateSession(context.Background(), opts)
 	if err != nil {
 		logging.Logger().Error("failed to create session", zap.String("backend", backendName), zap.Error(err))
+		var sbxErr *tmux.SandboxError
+		if errors.As(err, &sbxErr) {
+			m.publish("backend/"+backendName, eventbus.EventSandboxLoadFailed, eventbus.SandboxLoadFailed{
+				Backend: backendName,
+				Layer:   sbxErr.Layer,
+				Name:    sbxErr.Name,
+				Error:   sbxErr.Err.Error(),
+			})
+		}
 		return nil, err
 	}
 
 	// Wire up state change callback
 	if tmuxSess, ok := sess.(*tmux.Session); ok {
-		tmuxSess.OnStateChange = m.OnStateChange
-		tmuxSess.OnCrashRestart = func(sessionID string) {
-			msg := mailbox.NewMessage("user", sessionID, mailbox.MessageTypePromptRequest, "continue", "Continue working.")
-			m.mailManager.DeliverToInbox(sessionID, msg)
-		}
+		m.wireSession(tmuxSess)
 		// Emit initial state change event
 		if m.OnStateChange != nil {
 			m.OnStateChange(sess.ID(), "stopped", sess.State())
@@ -118,11 +172,82 @@ func (m *Manager) New(opts backend.SessionOptions, backendName string) (backend.
 
 	// Create mailbox structure for new session
 	m.mailManager.EnsureMailbox(sess.ID())
+	m.saveRegistry()
+	m.publish(sess.ID(), eventbus.EventSessionCreated, eventbus.SessionCreated{
+		Backend: backendName,
+		Cwd:     opts.CWD,
+		Sandbox: opts.Sandbox,
+		Model:   opts.Model,
+	})
 
 	logging.Logger().Info("session created", zap.String("id", sess.ID()), zap.String("backend", backendName))
 	return sess, nil
 }
 
+// wireSession installs the manager callbacks on a tmux session.
+// Used for both new and recovered sessions so they behave identically.
+func (m *Manager) wireSession(tmuxSess *tmux.Session) {
+	tmuxSess.OnStateChange = func(sessionID, oldState, newState string) {
+		if m.OnStateChange != nil {
+			m.OnStateChange(sessionID, oldState, newState)
+		}
+		m.saveRegistry()
+	}
+	tmuxSess.OnCrashRestart = func(sessionID string) {
+		msg := mailbox.NewMessage("user", sessionID, mailbox.MessageTypePromptRequest, "continue", "Continue working.")
+		m.mailManager.DeliverToInbox(sessionID, msg)
+	}
+	tmuxSess.OnMetadataChange = func(sessionID string) {
+		m.saveRegistry()
+	}
+	tmuxSess.OnEvent = func(sessionID, eventType string, data any) {
+		m.publish(sessionID, eventType, data)
+	}
+}
+
+// SetRegistry attaches a persistent session registry and immediately adopts
+// any tmux windows left over from a previous daemon, restoring their
+// persisted metadata. Returns the recovered session IDs.
+func (m *Manager) SetRegistry(r *Registry) ([]string, error) {
+	records, err := r.Load()
+
+	m.mu.Lock()
+	m.registry = r
+	m.records = records
+	m.mu.Unlock()
+
+	return m.Recover(), err
+}
+
+// saveRegistry writes a snapshot of all tmux sessions to the registry.
+// Saves run from concurrent callbacks, so each one holds saveMu from
+// snapshot to write: an older snapshot can never be written last.
+func (m *Manager) saveRegistry() {
+	m.saveMu.Lock()
+	defer m.saveMu.Unlock()
+
+	m.mu.RLock()
+	r := m.registry
+	snaps := make([]tmux.Snapshot, 0, len(m.sessions))
+	for _, sess := range m.sessions {
+		if tmuxSess, ok := sess.(*tmux.Session); ok {
+			snaps = append(snaps, tmuxSess.Snapshot())
+		}
+	}
+	m.mu.RUnlock()
+
+	if r == nil {
+		return
+	}
+
+	sort.Slice(snaps, func(i, j int) bool {
+		return snaps[i].CreatedAt.Before(snaps[j].CreatedAt)
+	})
+	if err := r.Save(snaps); err != nil {
+		logging.Logger().Warn("failed to save session registry", zap.Error(err))
+	}
+}
+
 // Get returns a session by ID
 func (m *Manager) Get(id string) backend.Session {
 	m.mu.RLock()
@@ -172,17 +297,43 @@ func (m *Manager) List() []string {
 // Remove removes a session from the manager
 func (m *Manager) Remove(id string) {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-	
-	if _, exists := m.sessions[id]; exists {
+	_, exists := m.sessions[id]
+	if exists {
 		logging.Logger().Info("removing session", zap.String("id", id))
 		delete(m.sessions, id)
 	}
+	m.mu.Unlock()
+
+	if exists {
+		m.saveRegistry()
+		m.mailManager.RemoveMailbox(id)
+		m.guard.forget(id)
+	}
 }
 
-// Recover finds orphaned tmux windows and adopts them back into the manager.
-// Returns the list of recovered session IDs.
+// Recover finds orphaned tmux windows and adopts them back into the manager,
+// applying any persisted registry metadata. Returns the recovered session IDs.
 func (m *Manager) Recover() []string {
+	recovered := m.adoptOrphans()
+	m.saveRegistry()
+
+	// Published outside adoptOrphans, which holds m.mu
+	for _, id := range recovered {
+		sess := m.Get(id)
+		if sess == nil {
+			continue
+		}
+		meta := sess.Metadata()
+		ev := eventbus.SessionRecovered{Backend: meta.Backend, Cwd: meta.Cwd, Alias: meta.Alias}
+		if tmuxSess, ok := sess.(*tmux.Session); ok {
+			ev.Role = tmuxSess.GetRole()
+		}
+		m.publish(id, eventbus.EventSessionRecovered, ev)
+	}
+	return recovered
+}
+
+func (m *Manager) adoptOrphans() []string {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -207,11 +358,15 @@ func (m *Manager) Recover() []string {
 				continue
 			}
 
-			// Wire up state change callback
 			if tmuxSess, ok := sess.(*tmux.Session); ok {
-				tmuxSess.OnStateChange = m.OnStateChange
+				if snap, ok := m.records[sess.ID()]; ok {
+					tmuxSess.Restore(snap)
+					delete(m.records, sess.ID())
+				}
+				m.wireSession(tmuxSess)
 			}
 
+			tracked[sess.ID()] = true
 			m.sessions[sess.ID()] = sess
 			m.mailManager.EnsureMailbox(sess.ID())
 			recovered = append(recovered, sess.ID())
@@ -228,7 +383,8 @@ func (m *Manager) Stop() {
 	m.wg.Wait()
 }
 
-// mailProcessingLoop processes mailboxes every 5 seconds.
+// mailProcessingLoop processes mailboxes every 5 seconds, or immediately
+// when high-priority mail is queued or delivered.
 func (m *Manager) mailProcessingLoop() {
 	defer m.wg.Done()
 	defer func() {
@@ -239,6 +395,8 @@ func (m *Manager) mailProcessingLoop() {
 
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
+	gcTicker := time.NewTicker(attachmentGCInterval)
+	defer gcTicker.Stop()
 
 	for {
 		select {
@@ -246,10 +404,45 @@ func (m *Manager) mailProcessingLoop() {
 			return
 		case <-ticker.C:
 			m.processMailboxes()
+		case <-m.wakeCh:
+			m.processMailboxes()
+		case <-gcTicker.C:
+			m.pruneMailboxes()
+			m.collectAttachments()
 		}
 	}
 }
 
+// attachmentGCInterval is how often attachment contents no message refers
+// to any more are deleted; files written or reused more recently are kept
+const attachmentGCInterval = time.Hour
+
+// collectAttachments deletes unreferenced attachment contents
+func (m *Manager) collectAttachments() {
+	n, err := m.mailManager.CollectAttachments(attachmentGCInterval)
+	if err != nil {
+		logging.Logger().Warn("failed to collect attachments", zap.Error(err))
+	} else if n > 0 {
+		logging.Logger().Info("collected unreferenced attachments", zap.Int("count", n))
+	}
+}
+
+// pruneMailboxes drops the mailboxes of sessions that are gone once they
+// are past the retention period
+func (m *Manager) pruneMailboxes() {
+	if pruned := m.mailManager.Prune(m.List(), config.MailboxRetention); len(pruned) > 0 {
+		logging.Logger().Info("pruned mailboxes of dead sessions", zap.Strings("ids", pruned))
+	}
+}
+
+// wake runs the mail loop now instead of at the next tick (non-blocking)
+func (m *Manager) wake() {
+	select {
+	case m.wakeCh <- struct{}{}:
+	default:
+	}
+}
+
 // processMailboxes handles outbox delivery and inbox processing.
 func (m *Manager) processMailboxes() {
 	defer func() {
@@ -265,28 +458,43 @@ func (m *Manager) processMailboxes() {
 	}
 	m.mu.RUnlock()
 	
-	// 1. Deliver outbound messages in batch (drain all outboxes)
+	// 0. Expire stale messages so they are neither delivered nor nudged about
+	m.expireMessages()
+	m.checkOverdueRequests()
+
+	// 1. Deliver outbound messages in batch (drain all outboxes). Messages are
+	// attempted independently, so one waiting out its retry backoff does not
+	// hold up the rest of the outbox.
+	now := time.Now().Unix()
 	allSenders := append([]string{"user"}, m.List()...)
 	for _, senderID := range allSenders {
-		for m.mailManager.HasOutbox(senderID) {
-			msg, err := m.mailManager.PeekOutbox(senderID)
-			if err != nil {
-				logging.Logger().Error("failed to peek outbox", zap.String("sender", senderID), zap.Error(err))
-				break
+		for _, msg := range m.mailManager.GetOutbox(senderID) {
+			if msg.NextAttempt > now {
+				continue
 			}
-			// Deliver first, then remove only if successful
-			if err := m.mailManager.DeliverToInbox(msg.To, msg); err != nil {
-				// Receiver doesn't exist - move to dead letter (completed)
-				m.mailManager.RemoveFromOutbox(senderID)
-				if msg.Metadata == nil {
-					msg.Metadata = make(map[string]interface{})
+			// Resolve alias:/role:/cwd: addresses, then deliver; remove only if successful
+			to, err := m.Resolve(msg.To)
+			if err == nil {
+				if !m.guard.allow(senderID, to, time.Now()) {
+					// Rate limited or paused as a loop: held, not failed
+					continue
 				}
-				msg.Metadata["error"] = err.Error()
-				m.mailManager.MoveToCompleted(senderID, msg)
-				logging.Logger().Warn("message undeliverable", zap.String("to", msg.To), zap.Error(err))
+				err = m.mailManager.DeliverToInbox(to, msg)
+			}
+			if errors.Is(err, mailbox.ErrDuplicateMessage) {
+				// Already delivered (e.g. before a crash) - just drop the outbox copy
+				m.mailManager.RemoveFromOutboxByID(senderID, msg.ID)
+				logging.Logger().Warn("dropping duplicate message", zap.String("id", msg.ID), zap.String("to", msg.To))
+			} else if err != nil {
+				// Receiver doesn't exist (yet) - e.g. a session still being recovered,
+				// or no idle session for a role
+				m.deliveryFailed(senderID, msg, err)
 			} else {
 				// Remove only after successful delivery
-				m.mailManager.RemoveFromOutbox(senderID)
+				m.mailManager.RemoveFromOutboxByID(senderID, msg.ID)
+				if n := m.guard.record(senderID, to, time.Now()); n > 0 {
+					m.loopDetected(senderID, to, n)
+				}
 			}
 		}
 	}
@@ -305,29 +513,200 @@ func (m *Manager) processMailboxes() {
 			continue
 		}
 		
-		if tmuxSess.IdleDuration() < 5*time.Second {
+		// Check if inbox has messages worth a nudge
+		if !m.mailManager.HasNudgeMessages(sess.ID()) {
 			continue
 		}
 
-		// Check if inbox has messages
-		if !m.mailManager.HasPendingMessages(sess.ID()) {
+		// High-priority mail bypasses the idle delay
+		urgent := m.mailManager.HasHighPriorityMessages(sess.ID())
+		if !urgent && tmuxSess.IdleDuration() < 5*time.Second {
 			continue
 		}
 		
 		// Prompt agent to check inbox
+		prompt := "You have new messages, check your inbox and respond appropriately."
+		if urgent {
+			prompt = "You have new high-priority messages, check your inbox and handle them first."
+		}
 		ctx := context.Background()
-		_, err := sess.Send(ctx, "You have new messages, check your inbox and respond appropriately.")
+		_, err := sess.Send(ctx, prompt)
 		if err != nil {
 			logging.Logger().Error("failed to prompt agent", zap.String("session", sess.ID()), zap.Error(err))
 		}
 	}
 }
 
+// deliveryFailed records a failed delivery attempt. The message stays in the
+// outbox and is retried with exponential backoff; once config.MailMaxAttempts
+// is reached it moves to the sender's dead-letter folder and a DeliveryFailed
+// event is published.
+func (m *Manager) deliveryFailed(senderID string, msg *mailbox.Message, cause error) {
+	attempts, next, err := m.mailManager.RecordDeliveryFailure(senderID, msg.ID, cause.Error(), retryDelay)
+	if err != nil {
+		logging.Logger().Error("failed to record delivery attempt", zap.String("id", msg.ID), zap.Error(err))
+		return
+	}
+	if attempts < config.MailMaxAttempts {
+		logging.Logger().Info("message undeliverable, will retry", zap.String("id", msg.ID),
+			zap.String("to", msg.To), zap.Int("attempt", attempts), zap.Time("next", next), zap.Error(cause))
+		return
+	}
+
+	reason := fmt.Sprintf("undeliverable after %d attempts: %v", attempts, cause)
+	dead, err := m.mailManager.MoveToDeadLetter(senderID, msg.ID, reason)
+	if err != nil {
+		logging.Logger().Error("failed to dead-letter message", zap.String("id", msg.ID), zap.Error(err))
+		return
+	}
+	logging.Logger().Warn("message undeliverable", zap.String("id", dead.ID), zap.String("to", dead.To), zap.Error(cause))
+
+	if m.eventBus != nil {
+		m.eventBus.Publish(senderID, eventbus.EventDeliveryFailed, map[string]any{
+			"id":       dead.ID,
+			"to":       dead.To,
+			"type":     dead.Type,
+			"subject":  dead.Subject,
+			"attempts": attempts,
+			"reason":   reason,
+		})
+	}
+}
+
+// expireMessages drops expired mail and tells each sender via a
+// MessageExpired event that its message was never handled.
+func (m *Manager) expireMessages() {
+	for _, e := range m.mailManager.ExpireMessages(time.Now()) {
+		msg := e.Message
+		logging.Logger().Info("message expired", zap.String("id", msg.ID),
+			zap.String("from", msg.From), zap.String("to", msg.To), zap.String("folder", e.Folder))
+		if m.eventBus != nil {
+			m.eventBus.Publish(msg.From, eventbus.EventMessageExpired, map[string]any{
+				"id":         msg.ID,
+				"to":         msg.To,
+				"type":       msg.Type,
+				"subject":    msg.Subject,
+				"expires_at": msg.ExpiresAt,
+				"folder":     e.Folder,
+			})
+		}
+	}
+}
+
+// loopDetected reports a pair of agents paused by the loop detector: it
+// publishes MailLoopDetected and leaves a SYSTEM_NOTICE in the user inbox
+// explaining how to resume delivery.
+func (m *Manager) loopDetected(a, b string, count int) {
+	logging.Logger().Warn("mail loop detected, pausing delivery", zap.String("a", a), zap.String("b", b),
+		zap.Int("messages", count), zap.Duration("window", config.MailLoopWindow))
+	if m.eventBus != nil {
+		m.eventBus.Publish(a, eventbus.EventMailLoopDetected, map[string]any{
+			"participants": []string{a, b},
+			"messages":     count,
+			"window":       config.MailLoopWindow.String(),
+		})
+	}
+
+	notice := mailbox.NewMessage("anvillm", "user", mailbox.MessageTypeSystemNotice,
+		fmt.Sprintf("Mail loop paused: %s <-> %s", a, b),
+		fmt.Sprintf("%s and %s exchanged %d messages within %s without user involvement. "+
+			"Delivery between them is paused; their pending messages stay in the outbox. "+
+			"To resume, write \"unpause %s %s\" to user/ctl.",
+			a, b, count, config.MailLoopWindow, a, b))
+	if err := m.mailManager.DeliverToInbox("user", notice); err != nil {
+		logging.Logger().Warn("failed to deliver loop notice", zap.Error(err))
+	}
+}
+
+// Unpause resumes mail delivery between two agents paused by the loop
+// detector
+func (m *Manager) Unpause(a, b string) error {
+	return m.guard.unpause(a, b)
+}
+
+// checkOverdueRequests reports requests whose respond_by passed without a
+// response and, if config.MailOverdueNudge is set, reminds the recipient if
+// it is idle.
+func (m *Manager) checkOverdueRequests() {
+	for _, o := range m.mailManager.OverdueRequests(time.Now()) {
+		req := o.Request
+		logging.Logger().Info("response overdue", zap.String("id", req.ID),
+			zap.String("from", req.From), zap.String("to", o.Participant))
+		if m.eventBus != nil {
+			m.eventBus.Publish(req.From, eventbus.EventResponseOverdue, map[string]any{
+				"id":         req.ID,
+				"to":         o.Participant,
+				"type":       req.Type,
+				"subject":    req.Subject,
+				"respond_by": req.RespondBy,
+			})
+		}
+
+		if !config.MailOverdueNudge {
+			continue
+		}
+		sess := m.Get(o.Participant)
+		if sess == nil || sess.State() != "idle" {
+			continue
+		}
+		prompt := fmt.Sprintf("A response to message %s from %s (%q) is overdue. Reply with a %s message whose in_reply_to is %s.",
+			req.ID, req.From, req.Subject, responseType(req.Type), req.ID)
+		if _, err := sess.Send(context.Background(), prompt); err != nil {
+			logging.Logger().Error("failed to prompt agent", zap.String("session", o.Participant), zap.Error(err))
+		}
+	}
+}
+
+// responseType names the response type matching a request type
+// (QUERY_REQUEST -> QUERY_RESPONSE); other types get a generic hint.
+func responseType(t mailbox.MessageType) string {
+	if base, ok := strings.CutSuffix(string(t), "_REQUEST"); ok {
+		return base + "_RESPONSE"
+	}
+	return "*_RESPONSE"
+}
+
+// publishMessageEvent publishes a lifecycle event for a message on behalf of
+// its sender, so senders can follow their mail by filtering on source.
+// participant is the recipient whose inbox holds the message.
+func (m *Manager) publishMessageEvent(evType, participant string, msg *mailbox.Message) {
+	if m.eventBus == nil {
+		return
+	}
+	m.eventBus.Publish(msg.From, evType, map[string]any{
+		"id":           msg.ID,
+		"to":           participant,
+		"type":         msg.Type,
+		"subject":      msg.Subject,
+		"queued_at":    msg.QueuedAt,
+		"delivered_at": msg.DeliveredAt,
+		"read_at":      msg.ReadAt,
+		"completed_at": msg.CompletedAt,
+	})
+}
+
+// retryDelay returns the backoff before the next delivery attempt, given the
+// number of attempts that have already failed (at least one).
+func retryDelay(failed int) time.Duration {
+	delay := config.MailRetryBackoff
+	for i := 1; i < failed && delay < config.MailRetryMaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, config.MailRetryMaxBackoff)
+}
+
 // GetMailManager returns the mailbox manager (guaranteed non-nil)
 func (m *Manager) GetMailManager() *mailbox.Manager {
 	return m.mailManager
 }
 
+// publish emits an event if an event bus is set
+func (m *Manager) publish(source, evType string, data any) {
+	if m.eventBus != nil {
+		m.eventBus.Publish(source, evType, data)
+	}
+}
+
 // SetEventBus sets the event bus for emitting events.
 func (m *Manager) SetEventBus(bus *eventbus.Bus) {
 	m.mu.Lock()
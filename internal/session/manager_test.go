@@ -0,0 +1,86 @@
+package session
+
+import (
+	"anvillm/internal/config"
+	"anvillm/internal/eventbus"
+	"anvillm/internal/mailbox"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetryDelay(t *testing.T) {
+	defer func(backoff, max time.Duration) {
+		config.MailRetryBackoff, config.MailRetryMaxBackoff = backoff, max
+	}(config.MailRetryBackoff, config.MailRetryMaxBackoff)
+	config.MailRetryBackoff, config.MailRetryMaxBackoff = 10*time.Second, time.Minute
+
+	tests := []struct {
+		failed int
+		want   time.Duration
+	}{
+		{0, 10 * time.Second},
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{4, time.Minute},
+		{50, time.Minute},
+	}
+	for _, tt := range tests {
+		if got := retryDelay(tt.failed); got != tt.want {
+			t.Errorf("retryDelay(%d) = %v, want %v", tt.failed, got, tt.want)
+		}
+	}
+}
+
+func TestDeliveryFailedDeadLetters(t *testing.T) {
+	defer func(n int) { config.MailMaxAttempts = n }(config.MailMaxAttempts)
+	config.MailMaxAttempts = 3
+
+	m := NewManager(nil)
+	bus := eventbus.New()
+	m.SetEventBus(bus)
+	events, cancel := bus.Subscribe()
+	defer cancel()
+
+	mail := m.GetMailManager()
+	msg := mailbox.NewMessage("user", "gone", mailbox.MessageTypePromptRequest, "s", "b")
+	mail.AddToOutbox("user", msg)
+	cause := errors.New("no session gone")
+
+	for attempt := 1; attempt < config.MailMaxAttempts; attempt++ {
+		m.deliveryFailed("user", msg, cause)
+		out := mail.GetOutbox("user")
+		if len(out) != 1 || out[0].Retries != attempt || out[0].NextAttempt <= time.Now().Unix() {
+			t.Fatalf("attempt %d: outbox %+v", attempt, out)
+		}
+	}
+	m.deliveryFailed("user", msg, cause)
+
+	if out := mail.GetOutbox("user"); len(out) != 0 {
+		t.Errorf("still in the outbox after %d attempts", config.MailMaxAttempts)
+	}
+	dead := mail.GetDeadLetter("user")
+	if len(dead) != 1 || dead[0].ID != msg.ID {
+		t.Fatalf("dead-letter folder %+v", dead)
+	}
+	if want := "undeliverable after 3 attempts: no session gone"; dead[0].Metadata["error"] != want {
+		t.Errorf("reason %q, want %q", dead[0].Metadata["error"], want)
+	}
+
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case e := <-events:
+			if e.Type != eventbus.EventDeliveryFailed {
+				continue
+			}
+			if data := e.Data.(map[string]any); data["id"] != msg.ID || data["attempts"] != 3 {
+				t.Errorf("event data %v", data)
+			}
+			return
+		case <-timeout:
+			t.Fatal("no DeliveryFailed event")
+		}
+	}
+}
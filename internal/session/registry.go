@@ -0,0 +1,90 @@
+package session
+
+import (
+	"anvillm/internal/backend/tmux"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Registry persists session metadata to a JSON file so that sessions
+// adopted from tmux after a daemon restart keep their full identity
+// (context, creation time, crash count, ...), not just what tmux window
+// options can carry.
+type Registry struct {
+	path string
+	mu   sync.Mutex
+}
+
+// registryFile is the on-disk format of the registry.
+type registryFile struct {
+	Sessions []tmux.Snapshot `json:"sessions"`
+}
+
+// NewRegistry creates a registry backed by the file at path.
+func NewRegistry(path string) *Registry {
+	return &Registry{path: path}
+}
+
+// Load reads all persisted session records, keyed by session ID.
+// A missing file is not an error (first run).
+func (r *Registry) Load() (map[string]tmux.Snapshot, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	records := make(map[string]tmux.Snapshot)
+	data, err := os.ReadFile(r.path)
+	if os.IsNotExist(err) {
+		return records, nil
+	}
+	if err != nil {
+		return records, err
+	}
+
+	var f registryFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return records, err
+	}
+	for _, snap := range f.Sessions {
+		records[snap.ID] = snap
+	}
+	return records, nil
+}
+
+// Save replaces the registry contents with the given snapshots.
+// The file is written to a temp file, synced and renamed into place.
+func (r *Registry) Save(snaps []tmux.Snapshot) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	dir := filepath.Dir(r.path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(registryFile{Sessions: snaps}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(r.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), r.path)
+}
@@ -0,0 +1,216 @@
+package session
+
+import (
+	"anvillm/internal/backend"
+	"anvillm/internal/mailbox"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Address prefixes accepted in a message's "to" field besides a raw session ID
+const (
+	addrAlias = "alias:" // alias:<alias>  - the session with that alias
+	addrRole  = "role:"  // role:<role>    - one idle session with that role
+	addrCwd   = "cwd:"   // cwd:<path>     - one idle session in that directory
+	addrAll   = "all"    // all, all:role:<role>, all:cwd:<path> - every matching session
+)
+
+// IsBroadcast reports whether an address selects every matching session
+// (all, all:..., topic:...) rather than a single recipient.
+func IsBroadcast(to string) bool {
+	return to == addrAll || strings.HasPrefix(to, addrAll+":") || strings.HasPrefix(to, mailbox.TopicPrefix)
+}
+
+// SelectionPolicy picks the session that receives a message addressed to a
+// group (role: or cwd:). It returns nil if none of the candidates should
+// receive it right now; delivery is then retried later.
+type SelectionPolicy func(candidates []backend.Session) backend.Session
+
+// LongestIdle is the default selection policy: among idle sessions, pick the
+// one that has been idle the longest.
+func LongestIdle(candidates []backend.Session) backend.Session {
+	var best backend.Session
+	var bestIdle int64 = -1
+	for _, sess := range candidates {
+		if sess.State() != "idle" {
+			continue
+		}
+		var idle int64
+		if s, ok := sess.(interface{ IdleDuration() time.Duration }); ok {
+			idle = int64(s.IdleDuration())
+		}
+		if idle > bestIdle {
+			best, bestIdle = sess, idle
+		}
+	}
+	return best
+}
+
+// Resolve maps a message address to a participant ID. "user" and the IDs
+// of current sessions are returned unchanged; alias:, role: and cwd:
+// addresses are looked up among the current sessions. Any other ID is an
+// error, even if a mailbox of a session that is gone is still kept for it.
+func (m *Manager) Resolve(to string) (string, error) {
+	if strings.HasPrefix(to, addrAlias) {
+		return m.resolveAlias(strings.TrimPrefix(to, addrAlias))
+	}
+	match := groupMatcher(to)
+	if match == nil {
+		if to != "user" && m.Get(to) == nil {
+			return "", fmt.Errorf("no session %s", to)
+		}
+		return to, nil
+	}
+
+	m.mu.RLock()
+	policy := m.SelectionPolicy
+	var candidates []backend.Session
+	for _, sess := range m.sessions {
+		if match(sess) {
+			candidates = append(candidates, sess)
+		}
+	}
+	m.mu.RUnlock()
+
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("no session matches %s", to)
+	}
+	if policy == nil {
+		policy = LongestIdle
+	}
+	sess := policy(candidates)
+	if sess == nil {
+		return "", fmt.Errorf("no session available for %s", to)
+	}
+	return sess.ID(), nil
+}
+
+// ExpandRecipients turns the addresses of a mail write into the list of
+// per-recipient addresses to fan out to. Broadcast selectors (all,
+// all:role:<role>, all:cwd:<path>) expand to the matching session IDs and
+// topic:<name> to the topic's live subscribers, excluding the sender; other
+// addresses are kept as-is and resolved at delivery time. Duplicates are
+// dropped. Publishing to a topic nobody listens to is not an error: if only
+// topics were addressed, the result may be empty.
+func (m *Manager) ExpandRecipients(senderID string, to []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var recipients []string
+	add := func(id string) {
+		if !seen[id] {
+			seen[id] = true
+			recipients = append(recipients, id)
+		}
+	}
+
+	topicsOnly := len(to) > 0
+	for _, addr := range to {
+		if topic, ok := strings.CutPrefix(addr, mailbox.TopicPrefix); ok {
+			if err := mailbox.ValidateTopic(topic); err != nil {
+				return nil, err
+			}
+			for _, id := range m.mailManager.Subscribers(topic) {
+				if id != senderID && (id == "user" || m.Get(id) != nil) {
+					add(id)
+				}
+			}
+			continue
+		}
+		topicsOnly = false
+
+		if !IsBroadcast(addr) {
+			if addr == "" {
+				return nil, fmt.Errorf("empty recipient address")
+			}
+			add(addr)
+			continue
+		}
+
+		match := func(backend.Session) bool { return true }
+		if addr != addrAll {
+			match = groupMatcher(strings.TrimPrefix(addr, addrAll+":"))
+			if match == nil {
+				return nil, fmt.Errorf("invalid broadcast address %s: use all, all:role:<role> or all:cwd:<path>", addr)
+			}
+		}
+		matched := 0
+		for _, id := range m.List() {
+			if sess := m.Get(id); sess != nil && id != senderID && match(sess) {
+				add(id)
+				matched++
+			}
+		}
+		if matched == 0 {
+			return nil, fmt.Errorf("no session matches %s", addr)
+		}
+	}
+
+	if len(recipients) == 0 && !topicsOnly {
+		return nil, fmt.Errorf("no recipients")
+	}
+	return recipients, nil
+}
+
+// groupMatcher returns a predicate for role: and cwd: addresses, or nil if
+// the address is not a group address.
+func groupMatcher(addr string) func(backend.Session) bool {
+	switch {
+	case strings.HasPrefix(addr, addrRole):
+		role := strings.TrimPrefix(addr, addrRole)
+		return func(sess backend.Session) bool {
+			s, ok := sess.(interface{ GetRole() string })
+			return ok && s.GetRole() == role
+		}
+	case strings.HasPrefix(addr, addrCwd):
+		cwd := filepath.Clean(strings.TrimPrefix(addr, addrCwd))
+		return func(sess backend.Session) bool {
+			return filepath.Clean(sess.Metadata().Cwd) == cwd
+		}
+	}
+	return nil
+}
+
+// ParticipantIDs returns the IDs of every current session a search term
+// refers to: alias:<alias>, role:<role> and cwd:<path> as in addresses, or a
+// bare alias. Unlike Resolve, a group term yields all its members, busy or
+// not, and an ambiguous alias yields every session using it.
+func (m *Manager) ParticipantIDs(term string) []string {
+	match := groupMatcher(term)
+	if match == nil {
+		alias := strings.TrimPrefix(term, addrAlias)
+		match = func(sess backend.Session) bool {
+			return sess.Metadata().Alias == alias
+		}
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var ids []string
+	for id, sess := range m.sessions {
+		if match(sess) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func (m *Manager) resolveAlias(alias string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var found []string
+	for id, sess := range m.sessions {
+		if sess.Metadata().Alias == alias {
+			found = append(found, id)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", fmt.Errorf("no session with alias %s", alias)
+	case 1:
+		return found[0], nil
+	default:
+		return "", fmt.Errorf("alias %s is ambiguous: %s", alias, strings.Join(found, ", "))
+	}
+}
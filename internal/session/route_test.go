@@ -0,0 +1,138 @@
+package session
+
+import (
+	"anvillm/internal/backend"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSession is a backend.Session with just enough behaviour for routing.
+// Methods it does not define panic through the nil embedded interface.
+type fakeSession struct {
+	backend.Session
+	id, state, alias, role, cwd string
+	idle                        time.Duration
+}
+
+func (s *fakeSession) ID() string                  { return s.id }
+func (s *fakeSession) State() string               { return s.state }
+func (s *fakeSession) GetRole() string             { return s.role }
+func (s *fakeSession) IdleDuration() time.Duration { return s.idle }
+func (s *fakeSession) CreatedAt() time.Time        { return time.Time{} }
+func (s *fakeSession) Metadata() backend.SessionMetadata {
+	return backend.SessionMetadata{Alias: s.alias, Cwd: s.cwd}
+}
+
+// newRouted returns a manager holding the given sessions
+func newRouted(sessions ...*fakeSession) *Manager {
+	m := NewManager(nil)
+	for _, sess := range sessions {
+		m.sessions[sess.id] = sess
+	}
+	return m
+}
+
+func TestResolve(t *testing.T) {
+	m := newRouted(
+		&fakeSession{id: "a1", state: "idle", alias: "rev", role: "reviewer", cwd: "/src/x", idle: time.Minute},
+		&fakeSession{id: "a2", state: "running", role: "reviewer", cwd: "/src/y"},
+		&fakeSession{id: "a3", state: "idle", alias: "dev", role: "developer", cwd: "/src/x/", idle: time.Hour},
+		&fakeSession{id: "a4", state: "idle", alias: "dev", role: "tester", cwd: "/src/z"},
+	)
+
+	tests := []struct {
+		to   string
+		want string // participant ID, or a substring of the error
+		err  bool
+	}{
+		{to: "user", want: "user"},
+		{to: "a2", want: "a2"},
+		{to: "gone", want: "no session gone", err: true},
+		{to: "alias:rev", want: "a1"},
+		{to: "alias:nope", want: "no session with alias nope", err: true},
+		{to: "alias:dev", want: "ambiguous", err: true},
+		{to: "role:reviewer", want: "a1"}, // a2 is busy
+		{to: "role:developer", want: "a3"},
+		{to: "role:ops", want: "no session matches role:ops", err: true},
+		{to: "cwd:/src/x", want: "a3"}, // idle longer than a1; trailing slash ignored
+		{to: "cwd:/src/x/", want: "a3"},
+		{to: "cwd:/src/y", want: "no session available for cwd:/src/y", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.to, func(t *testing.T) {
+			got, err := m.Resolve(tt.to)
+			if tt.err {
+				if err == nil || !strings.Contains(err.Error(), tt.want) {
+					t.Errorf("got %q, %v; want error containing %q", got, err, tt.want)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("got %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectionPolicy(t *testing.T) {
+	m := newRouted(
+		&fakeSession{id: "a1", state: "idle", role: "reviewer", idle: time.Hour},
+		&fakeSession{id: "a2", state: "idle", role: "reviewer"},
+	)
+	m.SelectionPolicy = func(candidates []backend.Session) backend.Session {
+		for _, sess := range candidates {
+			if sess.ID() == "a2" {
+				return sess
+			}
+		}
+		return nil
+	}
+	if got, err := m.Resolve("role:reviewer"); err != nil || got != "a2" {
+		t.Errorf("got %q, %v; want a2", got, err)
+	}
+}
+
+func TestExpandRecipients(t *testing.T) {
+	m := newRouted(
+		&fakeSession{id: "a1", state: "idle", role: "reviewer", cwd: "/src/x"},
+		&fakeSession{id: "a2", state: "running", role: "reviewer", cwd: "/src/y"},
+		&fakeSession{id: "a3", state: "idle", role: "developer", cwd: "/src/x"},
+	)
+	m.GetMailManager().EnsureMailbox("a3")
+	m.GetMailManager().Subscribe("a3", "builds")
+	m.GetMailManager().Subscribe("gone", "builds")
+
+	tests := []struct {
+		name string
+		to   []string
+		want []string
+		err  string
+	}{
+		{name: "plain addresses kept", to: []string{"role:reviewer", "a3", "a3"}, want: []string{"a3", "role:reviewer"}},
+		{name: "all but the sender", to: []string{"all"}, want: []string{"a2", "a3"}},
+		{name: "all by role", to: []string{"all:role:reviewer"}, want: []string{"a2"}},
+		{name: "all by cwd", to: []string{"all:cwd:/src/x"}, want: []string{"a3"}},
+		{name: "live topic subscribers", to: []string{"topic:builds"}, want: []string{"a3"}},
+		{name: "topic without listeners", to: []string{"topic:none"}},
+		{name: "no broadcast match", to: []string{"all:role:ops"}, err: "no session matches"},
+		{name: "bad broadcast", to: []string{"all:x"}, err: "invalid broadcast address"},
+		{name: "empty", to: nil, err: "no recipients"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := m.ExpandRecipients("a1", tt.to)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("got %v, %v; want error containing %q", got, err, tt.err)
+				}
+				return
+			}
+			slices.Sort(got)
+			if err != nil || !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, %v; want %v", got, err, tt.want)
+			}
+		})
+	}
+}
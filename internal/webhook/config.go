@@ -0,0 +1,101 @@
+// Package webhook POSTs events from the event bus to HTTP endpoints
+// configured in webhooks.yaml, signing the payloads and retrying failed
+// deliveries.
+package webhook
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Defaults for rules that leave the timeout or retry policy unset
+const (
+	DefaultTimeout    = 10 * time.Second
+	DefaultAttempts   = 3
+	DefaultBackoff    = time.Second
+	DefaultMaxBackoff = time.Minute
+)
+
+// Rule is one webhook: the events it receives and where they are sent
+type Rule struct {
+	Name    string            `yaml:"name"`
+	URL     string            `yaml:"url"`
+	Types   []string          `yaml:"types"`   // event types to send; empty for all
+	Sources []string          `yaml:"sources"` // event sources (or prefixes, e.g. "beads"); empty for all
+	Headers map[string]string `yaml:"headers"` // extra request headers, e.g. Authorization
+	Secret  string            `yaml:"secret"`  // signs the body with HMAC-SHA256 when set
+	Timeout time.Duration     `yaml:"timeout"` // per request
+	Retry   RetryPolicy       `yaml:"retry"`
+}
+
+// RetryPolicy controls redelivery after a network error, a 429 or a 5xx
+// response. Other responses are final.
+type RetryPolicy struct {
+	Attempts   int           `yaml:"attempts"`    // total attempts per event
+	Backoff    time.Duration `yaml:"backoff"`     // delay before the first retry, doubled after each
+	MaxBackoff time.Duration `yaml:"max_backoff"` // cap on the delay
+}
+
+// configFile is the on-disk format of webhooks.yaml
+type configFile struct {
+	Webhooks []Rule `yaml:"webhooks"`
+}
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// ConfigPath returns the path of the webhook configuration file
+func ConfigPath() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".config", "anvillm", "webhooks.yaml")
+}
+
+// Load reads the webhook rules from a YAML file and fills in defaults. A
+// missing file is not an error (no webhooks).
+func Load(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var f configFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	seen := make(map[string]bool)
+	for i := range f.Webhooks {
+		r := &f.Webhooks[i]
+		if !validName.MatchString(r.Name) {
+			return nil, fmt.Errorf("%s: invalid webhook name %q: must match [A-Za-z0-9_-]+", path, r.Name)
+		}
+		if seen[r.Name] {
+			return nil, fmt.Errorf("%s: duplicate webhook name %q", path, r.Name)
+		}
+		seen[r.Name] = true
+		if u, err := url.Parse(r.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("%s: webhook %q: invalid url %q", path, r.Name, r.URL)
+		}
+		if r.Timeout <= 0 {
+			r.Timeout = DefaultTimeout
+		}
+		if r.Retry.Attempts <= 0 {
+			r.Retry.Attempts = DefaultAttempts
+		}
+		if r.Retry.Backoff <= 0 {
+			r.Retry.Backoff = DefaultBackoff
+		}
+		if r.Retry.MaxBackoff <= 0 {
+			r.Retry.MaxBackoff = DefaultMaxBackoff
+		}
+	}
+	return f.Webhooks, nil
+}
@@ -0,0 +1,214 @@
+package webhook
+
+import (
+	"anvillm/internal/eventbus"
+	"anvillm/pkg/logging"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// SignatureHeader carries "sha256=<hex HMAC-SHA256 of the body>" when a
+// rule has a secret
+const SignatureHeader = "X-Anvillm-Signature"
+
+// queueSize is how many events a webhook queues while a delivery is in
+// progress; beyond it events are dropped (see eventbus.Subscription)
+const queueSize = 1024
+
+// Dispatcher delivers events to webhooks. Each webhook has its own
+// subscription and worker, so a slow or failing endpoint only delays its
+// own events, in order.
+type Dispatcher struct {
+	hooks  []*hook
+	client *http.Client
+	ctx    context.Context
+	stop   context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+type hook struct {
+	rule Rule
+	sub  *eventbus.Subscription
+
+	mu     sync.Mutex
+	status Status
+}
+
+// Status reports a webhook's deliveries so far
+type Status struct {
+	Name       string    `json:"name"`
+	URL        string    `json:"url"`
+	Queued     int       `json:"queued"`
+	Delivered  uint64    `json:"delivered"`
+	Failed     uint64    `json:"failed"` // events given up on
+	Retries    uint64    `json:"retries"`
+	LastSeq    uint64    `json:"last_seq"` // last event attempted
+	LastAt     time.Time `json:"last_at"`
+	LastResult string    `json:"last_result"` // HTTP status or error of the last attempt
+}
+
+// New starts delivering the events matching each rule
+func New(rules []Rule, bus *eventbus.Bus) *Dispatcher {
+	ctx, stop := context.WithCancel(context.Background())
+	d := &Dispatcher{client: &http.Client{}, ctx: ctx, stop: stop}
+	for _, r := range rules {
+		h := &hook{rule: r, status: Status{Name: r.Name, URL: r.URL}}
+		h.sub = bus.SubscribeWith(eventbus.SubscribeOptions{
+			Name:   "webhook/" + r.Name,
+			Filter: eventbus.Filter{Types: r.Types, Sources: r.Sources},
+			Buffer: queueSize,
+		})
+		d.hooks = append(d.hooks, h)
+		d.wg.Add(1)
+		go d.run(h)
+	}
+	return d
+}
+
+// Status returns the delivery status of every webhook, in file order
+func (d *Dispatcher) Status() []Status {
+	statuses := make([]Status, 0, len(d.hooks))
+	for _, h := range d.hooks {
+		h.mu.Lock()
+		st := h.status
+		h.mu.Unlock()
+		st.Queued = h.sub.Stats().Queued
+		statuses = append(statuses, st)
+	}
+	return statuses
+}
+
+// Close stops delivery, abandoning retries in progress and queued events
+func (d *Dispatcher) Close() {
+	d.stop()
+	for _, h := range d.hooks {
+		h.sub.Cancel()
+	}
+	d.wg.Wait()
+}
+
+func (d *Dispatcher) run(h *hook) {
+	defer d.wg.Done()
+	for e := range h.sub.C {
+		if d.ctx.Err() != nil {
+			return
+		}
+		d.deliver(h, e)
+	}
+}
+
+// deliver POSTs one event, retrying with exponential backoff
+func (d *Dispatcher) deliver(h *hook, e *eventbus.Event) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		h.record(e, failed, fmt.Sprintf("marshal: %v", err))
+		return
+	}
+
+	backoff := h.rule.Retry.Backoff
+	for attempt := 1; ; attempt++ {
+		result, retry, err := d.post(h.rule, e, body)
+		if err == nil {
+			h.record(e, delivered, result)
+			return
+		}
+		if !retry || attempt >= h.rule.Retry.Attempts {
+			if retry {
+				result = fmt.Sprintf("%s (gave up after %d attempts)", result, attempt)
+			}
+			h.record(e, failed, result)
+			logging.Logger().Warn("webhook delivery failed",
+				zap.String("webhook", h.rule.Name), zap.Uint64("seq", e.Seq), zap.String("type", e.Type), zap.Error(err))
+			return
+		}
+		h.record(e, retrying, result+" (retrying)")
+
+		select {
+		case <-time.After(backoff):
+		case <-d.ctx.Done():
+			return
+		}
+		backoff = min(backoff*2, h.rule.Retry.MaxBackoff)
+	}
+}
+
+// post makes one delivery attempt. It returns the response status (or the
+// error text), whether a failure is worth retrying, and the failure.
+func (d *Dispatcher) post(r Rule, e *eventbus.Event, body []byte) (string, bool, error) {
+	ctx, cancel := context.WithTimeout(d.ctx, r.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.URL, bytes.NewReader(body))
+	if err != nil {
+		return err.Error(), false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "anvillm-webhook")
+	req.Header.Set("X-Anvillm-Event", e.Type)
+	req.Header.Set("X-Anvillm-Delivery", e.ID)
+	for k, v := range r.Headers {
+		req.Header.Set(k, v)
+	}
+	if r.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(r.Secret, body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err.Error(), true, err
+	}
+	// Drain (a bounded amount of) the body so the connection is reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp.Status, false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return resp.Status, retry, fmt.Errorf("unexpected status %s", resp.Status)
+}
+
+// outcome is the result of a delivery attempt
+type outcome int
+
+const (
+	delivered outcome = iota
+	retrying          // failed, another attempt follows
+	failed            // failed, given up
+)
+
+// record updates the status after an attempt
+func (h *hook) record(e *eventbus.Event, o outcome, result string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	switch o {
+	case delivered:
+		h.status.Delivered++
+	case retrying:
+		h.status.Retries++
+	case failed:
+		h.status.Failed++
+	}
+	h.status.LastSeq = e.Seq
+	h.status.LastAt = time.Now()
+	h.status.LastResult = result
+}
+
+// Sign returns the signature header value for a body: "sha256=" followed
+// by the hex HMAC-SHA256 of the body keyed with secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
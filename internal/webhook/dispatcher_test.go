@@ -0,0 +1,178 @@
+package webhook
+
+import (
+	"anvillm/internal/eventbus"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// request is what the stand-in endpoint saw of one delivery
+type request struct {
+	at     time.Time
+	header http.Header
+	body   []byte
+}
+
+// sink is a local HTTP stand-in for a webhook endpoint. It answers with
+// the given status codes in turn, repeating the last one.
+type sink struct {
+	*httptest.Server
+	mu       sync.Mutex
+	codes    []int
+	requests []request
+}
+
+func newSink(t *testing.T, codes ...int) *sink {
+	s := &sink{codes: codes}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.mu.Lock()
+		s.requests = append(s.requests, request{at: time.Now(), header: r.Header, body: body})
+		code := s.codes[min(len(s.requests), len(s.codes))-1]
+		s.mu.Unlock()
+		w.WriteHeader(code)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *sink) received() []request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]request(nil), s.requests...)
+}
+
+// start runs a dispatcher for one rule against the sink
+func start(t *testing.T, r Rule) (*Dispatcher, *eventbus.Bus) {
+	bus := eventbus.New()
+	d := New([]Rule{r}, bus)
+	t.Cleanup(d.Close)
+	return d, bus
+}
+
+// waitStatus polls the webhook's status until done reports true
+func waitStatus(t *testing.T, d *Dispatcher, done func(Status) bool) Status {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		st := d.Status()[0]
+		if done(st) {
+			return st
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out, status %+v", st)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestDeliverSignedAndFiltered(t *testing.T) {
+	s := newSink(t, http.StatusOK)
+	d, bus := start(t, Rule{
+		Name:    "ci",
+		URL:     s.URL,
+		Types:   []string{eventbus.EventStateChange},
+		Headers: map[string]string{"Authorization": "Bearer token"},
+		Secret:  "s3cret",
+		Timeout: time.Second,
+		Retry:   RetryPolicy{Attempts: 1},
+	})
+
+	// Published first, so it would arrive first if the filter let it through
+	bus.Publish("a", eventbus.EventBotSend, "filtered out")
+	bus.Publish("a", eventbus.EventStateChange, map[string]string{"state": "idle"})
+	st := waitStatus(t, d, func(st Status) bool { return st.Delivered == 1 })
+
+	reqs := s.received()
+	if len(reqs) != 1 {
+		t.Fatalf("got %d requests, want 1", len(reqs))
+	}
+	req := reqs[0]
+	if got, want := req.header.Get(SignatureHeader), Sign("s3cret", req.body); got != want {
+		t.Errorf("signature %q, want %q", got, want)
+	}
+	if got := req.header.Get("X-Anvillm-Event"); got != eventbus.EventStateChange {
+		t.Errorf("event header %q, want %q", got, eventbus.EventStateChange)
+	}
+	if got := req.header.Get("Authorization"); got != "Bearer token" {
+		t.Errorf("authorization header %q", got)
+	}
+	if !strings.Contains(string(req.body), `"state":"idle"`) {
+		t.Errorf("body %s does not carry the event data", req.body)
+	}
+	if st.Failed != 0 || st.Retries != 0 || st.LastResult != "200 OK" {
+		t.Errorf("status %+v", st)
+	}
+}
+
+func TestRetryWithBackoff(t *testing.T) {
+	s := newSink(t, http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK)
+	backoff := 20 * time.Millisecond
+	d, bus := start(t, Rule{
+		Name:    "flaky",
+		URL:     s.URL,
+		Timeout: time.Second,
+		Retry:   RetryPolicy{Attempts: 3, Backoff: backoff, MaxBackoff: time.Second},
+	})
+
+	bus.Publish("a", eventbus.EventStateChange, nil)
+	st := waitStatus(t, d, func(st Status) bool { return st.Delivered == 1 })
+
+	reqs := s.received()
+	if len(reqs) != 3 {
+		t.Fatalf("got %d attempts, want 3", len(reqs))
+	}
+	if gap := reqs[1].at.Sub(reqs[0].at); gap < backoff {
+		t.Errorf("first retry after %v, want at least %v", gap, backoff)
+	}
+	if gap := reqs[2].at.Sub(reqs[1].at); gap < 2*backoff {
+		t.Errorf("second retry after %v, want at least %v (doubled)", gap, 2*backoff)
+	}
+	if st.Retries != 2 || st.Failed != 0 {
+		t.Errorf("status %+v, want 2 retries and no failures", st)
+	}
+}
+
+func TestStatusReportsFailures(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     int
+		attempts int // requests expected before giving up
+		result   string
+	}{
+		{name: "5xx gives up after the retries", code: http.StatusInternalServerError, attempts: 2, result: "500 Internal Server Error (gave up after 2 attempts)"},
+		{name: "4xx is final", code: http.StatusBadRequest, attempts: 1, result: "400 Bad Request"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSink(t, tt.code)
+			d, bus := start(t, Rule{
+				Name:    "down",
+				URL:     s.URL,
+				Timeout: time.Second,
+				Retry:   RetryPolicy{Attempts: 2, Backoff: time.Millisecond, MaxBackoff: time.Millisecond},
+			})
+
+			bus.Publish("a", eventbus.EventStateChange, nil)
+			st := waitStatus(t, d, func(st Status) bool { return st.Failed == 1 })
+
+			if n := len(s.received()); n != tt.attempts {
+				t.Errorf("got %d requests, want %d", n, tt.attempts)
+			}
+			if st.Delivered != 0 || st.Retries != uint64(tt.attempts-1) {
+				t.Errorf("status %+v", st)
+			}
+			if st.LastResult != tt.result {
+				t.Errorf("last result %q, want %q", st.LastResult, tt.result)
+			}
+			if st.LastSeq != 1 || st.Name != "down" || st.URL != s.URL {
+				t.Errorf("status %+v", st)
+			}
+		})
+	}
+}
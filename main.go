@@ -5,10 +5,14 @@ import (
 	"anvillm/internal/backend"
 	"anvillm/internal/backend/tmux"
 	"anvillm/internal/backends"
+	"anvillm/internal/config"
 	"anvillm/pkg/logging"
+	"anvillm/internal/mailbox"
+	"anvillm/internal/eventbus"
 	"anvillm/internal/maildir"
 	"anvillm/internal/p9"
 	"anvillm/internal/session"
+	"anvillm/internal/webhook"
 	"context"
 	"fmt"
 	"os"
@@ -200,6 +204,18 @@ func start(daemonize bool) {
 	mgr := session.NewManager(backendMap)
 	logging.Logger().Info("session manager initialized")
 
+	// User-defined message types extend the built-in ones
+	if err := mailbox.LoadTypes(mailbox.TypesPath()); err != nil {
+		logging.Logger().Warn("failed to load message types", zap.String("path", mailbox.TypesPath()), zap.Error(err))
+	}
+
+	// Restore persisted mailboxes so undelivered and unread mail survives restarts
+	mailboxDir := filepath.Join(os.Getenv("HOME"), ".local", "share", "anvillm", "mailbox")
+	if err := mgr.GetMailManager().SetStore(mailbox.NewStore(mailboxDir)); err != nil {
+		logging.Logger().Warn("failed to restore mailboxes", zap.String("dir", mailboxDir), zap.Error(err))
+	}
+	mgr.GetMailManager().SetAttachmentDir(filepath.Join(os.Getenv("HOME"), ".local", "share", "anvillm", "attachments"))
+
 	// Cleanup tmux sessions on exit
 	defer func() {
 		if r := recover(); r != nil {
@@ -220,13 +236,56 @@ func start(daemonize bool) {
 	}
 	defer srv.Close()
 
+	// Journal events so consumers can resume from a sequence number (events.d/since/<seq>)
+	journalPath := filepath.Join(os.Getenv("HOME"), ".local", "share", "anvillm", "events")
+	if journal, err := eventbus.OpenJournal(journalPath, config.EventJournalSegment, config.EventJournalSegments); err != nil {
+		logging.Logger().Warn("failed to open event journal", zap.String("path", journalPath), zap.Error(err))
+	} else {
+		srv.Events().SetJournal(journal)
+		defer journal.Close()
+	}
+
 	// Wire up event bus to session manager
 	mgr.SetEventBus(srv.Events())
 
-	// Start maildir writer for message persistence
+	// Restore sessions left running by a previous daemon (tmux windows survive crashes)
+	registryPath := filepath.Join(os.Getenv("HOME"), ".local", "share", "anvillm", "sessions.json")
+	recovered, err := mgr.SetRegistry(session.NewRegistry(registryPath))
+	if err != nil {
+		logging.Logger().Warn("failed to load session registry", zap.String("path", registryPath), zap.Error(err))
+	}
+	if len(recovered) > 0 {
+		logging.Logger().Info("recovered sessions", zap.Strings("ids", recovered))
+	}
+
+	// Mailboxes restored for sessions that did not survive (tmux windows are
+	// killed on shutdown) are kept readable for a while, then dropped
+	if pruned := mgr.GetMailManager().Prune(mgr.List(), config.MailboxRetention); len(pruned) > 0 {
+		logging.Logger().Info("pruned mailboxes of dead sessions", zap.Strings("ids", pruned))
+	}
+
+	// Start maildir writer for message persistence; the mailboxes record
+	// deliveries and completions in it directly and mail/query searches its index
 	mailDir := filepath.Join(os.Getenv("HOME"), ".local", "share", "anvillm", "mail")
 	mdWriter := maildir.New(mailDir, srv.Events())
 	defer mdWriter.Close()
+	srv.SetMailArchive(mdWriter)
+	mgr.GetMailManager().SetArchive(mdWriter)
+
+	// Replay the archive: mail received but never completed goes back into
+	// inboxes the mailbox store lost it from
+	if n := mdWriter.Replay(mgr.GetMailManager()); n > 0 {
+		logging.Logger().Info("restored messages from maildir", zap.Int("count", n))
+	}
+
+	// POST events to the webhooks in webhooks.yaml; events.d/webhooks reports deliveries
+	hooks, err := webhook.Load(webhook.ConfigPath())
+	if err != nil {
+		logging.Logger().Warn("failed to load webhooks", zap.String("path", webhook.ConfigPath()), zap.Error(err))
+	}
+	dispatcher := webhook.New(hooks, srv.Events())
+	defer dispatcher.Close()
+	srv.SetWebhooks(dispatcher)
 
 	logging.Logger().Info("anvillm started successfully", zap.String("socket", srv.SocketPath()))
 
@@ -51,7 +51,7 @@ def read_user_inbox():
     msgs.sort(key=lambda m: m.get("timestamp", 0), reverse=True)
     
     for msg in msgs:
-        mid = msg.get("id", "?")[:8]
+        mid = msg.get("id", "?")[-8:]  # UUIDv7: leading chars are the timestamp
         ts = msg.get("timestamp", 0)
         date = datetime.fromtimestamp(ts).strftime("%d-%b-%Y %H:%M:%S") if ts else "?"
         frm = msg.get("from", "?")[:12]
@@ -79,19 +79,27 @@ def update_window(wid, content):
 if __name__ == "__main__":
     os.environ["NAMESPACE"] = NAMESPACE
     last_refresh = 0
-    proc = subprocess.Popen(["9p", "read", "anvillm/events"], stdout=subprocess.PIPE, text=True,
-                            env={**os.environ, "NAMESPACE": NAMESPACE})
-    for line in proc.stdout:
-        try:
-            ev = json.loads(line.strip())
-            if ev.get("type") == "UserRecv":
-                now = time.time()
-                if now - last_refresh < 1:
-                    continue
-                last_refresh = now
-                wid = find_inbox_window()
-                if wid:
-                    content = read_user_inbox()
-                    update_window(wid, content)
-        except json.JSONDecodeError:
-            pass
+    last_seq = None
+    # Reconnect after the stream ends (e.g. daemon restart), resuming from
+    # the last seen sequence number so messages received meanwhile refresh too
+    while True:
+        path = "anvillm/events" if last_seq is None else f"anvillm/events.d/since/{last_seq}"
+        proc = subprocess.Popen(["9p", "read", path], stdout=subprocess.PIPE, text=True,
+                                env={**os.environ, "NAMESPACE": NAMESPACE})
+        for line in proc.stdout:
+            try:
+                ev = json.loads(line.strip())
+                last_seq = ev.get("seq", last_seq)
+                if ev.get("type") == "UserRecv":
+                    now = time.time()
+                    if now - last_refresh < 1:
+                        continue
+                    last_refresh = now
+                    wid = find_inbox_window()
+                    if wid:
+                        content = read_user_inbox()
+                        update_window(wid, content)
+            except json.JSONDecodeError:
+                pass
+        proc.wait()
+        time.sleep(2)
@@ -115,16 +115,24 @@ class Handler(BaseHTTPRequestHandler):
             self.send_error(404)
 
 def event_reader():
+    """Follow the event stream; after a disconnect (e.g. daemon restart),
+    resume from the last seen sequence number so no messages are missed."""
     os.environ["NAMESPACE"] = NAMESPACE
-    proc = subprocess.Popen(["9p", "read", "anvillm/events"], stdout=subprocess.PIPE, text=True)
-    for line in proc.stdout:
-        try:
-            ev = json.loads(line.strip())
-            if ev.get("type") in ("UserSend", "BotSend"):
-                with lock:
-                    events.append(ev)
-        except json.JSONDecodeError:
-            pass
+    last_seq = None
+    while True:
+        path = "anvillm/events" if last_seq is None else f"anvillm/events.d/since/{last_seq}"
+        proc = subprocess.Popen(["9p", "read", path], stdout=subprocess.PIPE, text=True)
+        for line in proc.stdout:
+            try:
+                ev = json.loads(line.strip())
+                last_seq = ev.get("seq", last_seq)
+                if ev.get("type") in ("UserSend", "BotSend"):
+                    with lock:
+                        events.append(ev)
+            except json.JSONDecodeError:
+                pass
+        proc.wait()
+        threading.Event().wait(2)
 
 def refresh_sessions():
     global sessions
@@ -0,0 +1,64 @@
+#!/usr/bin/env python3
+"""Local stand-in for a webhook endpoint: prints each event POSTed by anvillm.
+
+Usage: webhook_sink.py [--port 8787] [--secret <secret>] [--fail <n>]
+
+Point a rule in ~/.config/anvillm/webhooks.yaml at http://127.0.0.1:<port>/.
+With --secret, the X-Anvillm-Signature header is checked (401 on mismatch).
+With --fail, the first n requests get a 503, to exercise the retry policy.
+"""
+
+import argparse
+import hashlib
+import hmac
+import json
+from http.server import HTTPServer, BaseHTTPRequestHandler
+
+args = None
+failures_left = 0
+
+class Handler(BaseHTTPRequestHandler):
+    def do_POST(self):
+        global failures_left
+        body = self.rfile.read(int(self.headers.get("Content-Length", 0)))
+
+        if args.secret:
+            expected = "sha256=" + hmac.new(args.secret.encode(), body, hashlib.sha256).hexdigest()
+            if not hmac.compare_digest(expected, self.headers.get("X-Anvillm-Signature", "")):
+                print(f"bad signature for delivery {self.headers.get('X-Anvillm-Delivery')}", flush=True)
+                self.send_response(401)
+                self.end_headers()
+                return
+
+        if failures_left > 0:
+            failures_left -= 1
+            print(f"failing delivery {self.headers.get('X-Anvillm-Delivery')} ({failures_left} failures left)", flush=True)
+            self.send_response(503)
+            self.end_headers()
+            return
+
+        try:
+            event = json.loads(body)
+            print(f"{event.get('seq')}\t{event.get('type')}\t{event.get('source')}\t{json.dumps(event.get('data'))}", flush=True)
+        except json.JSONDecodeError:
+            print(f"invalid JSON: {body!r}", flush=True)
+        self.send_response(204)
+        self.end_headers()
+
+    def log_message(self, format, *a):
+        pass
+
+def main():
+    global args, failures_left
+    parser = argparse.ArgumentParser(description=__doc__.splitlines()[0])
+    parser.add_argument("--port", type=int, default=8787)
+    parser.add_argument("--secret", default="")
+    parser.add_argument("--fail", type=int, default=0)
+    args = parser.parse_args()
+    failures_left = args.fail
+
+    print(f"listening on http://127.0.0.1:{args.port}/", flush=True)
+    HTTPServer(("127.0.0.1", args.port), Handler).serve_forever()
+
+if __name__ == "__main__":
+    main()
@@ -11,13 +11,14 @@ fi
 ANVILLM="${ANVILLM_9MOUNT:-$HOME/mnt/anvillm}"
 inbox_dir="$ANVILLM/${AGENT_ID}/inbox"
 
-files=$(ls "$inbox_dir" 2>/dev/null | grep '\.json$' || true)
-if [ -z "$files" ]; then
+# The server lists the inbox in processing order (highest priority first,
+# then oldest), so take the first entry unsorted. Only that message is read:
+# reading a message file marks it read and may send a receipt.
+msg_file=$(ls -U "$inbox_dir" 2>/dev/null | grep '\.json$' | head -1 || true)
+if [ -z "$msg_file" ]; then
   echo "No messages"
   exit 0
 fi
-
-msg_file=$(echo "$files" | head -1)
 msg_path="${inbox_dir}/${msg_file}"
 msg_id="${msg_file%.json}"
 
@@ -29,8 +30,21 @@ body=$(echo "$data" | jq -r '.body // ""')
 
 echo "complete ${msg_id}" > "$ANVILLM/${AGENT_ID}/ctl" 2>/dev/null || true
 
+echo "ID: ${msg_id}"
 echo "From: ${from}"
 echo "Type: ${type}"
+priority=$(echo "$data" | jq -r '.priority // ""')
+if [ -n "$priority" ]; then echo "Priority: ${priority}"; fi
 echo "Subject: ${subject}"
+respond_by=$(echo "$data" | jq -r 'if .expects_response then (.respond_by // 0) else "" end')
+if [ -n "$respond_by" ]; then
+  if [ "$respond_by" != "0" ]; then
+    echo "Response-Expected: by $(date -d "@${respond_by}" '+%Y-%m-%d %H:%M:%S') (reply with --in-reply-to ${msg_id})"
+  else
+    echo "Response-Expected: yes (reply with --in-reply-to ${msg_id})"
+  fi
+fi
+echo "$data" | jq -r --arg dir "$ANVILLM/${AGENT_ID}/attachments/${msg_id}" \
+  '.attachments[]? | "Attachment: \($dir)/\(.name) (\(.size) bytes)"'
 echo ""
 echo "${body}"
@@ -0,0 +1,16 @@
+#!/bin/bash
+# capabilities: messaging
+# description: List valid message types with description and schemas (JSON array)
+set -euo pipefail
+
+ANVILLM="${ANVILLM_9MOUNT:-$HOME/mnt/anvillm}"
+
+if [ ! -d "$ANVILLM/types" ]; then
+  echo "[]"
+  exit 0
+fi
+
+for type_file in "$ANVILLM/types"/*; do
+  [ -f "$type_file" ] || continue
+  cat "$type_file"
+done | jq -s '.'
@@ -1,42 +1,39 @@
 #!/bin/bash
-# Search message history for an agent or user by regex pattern.
-# Usage: mail_search.sh --agent-id <agent-id|user> --pattern <regex> [--date YYYYMMdd]
+# Search message history (archive and live mailboxes) via anvillm/mail/query.
+# Usage: mail_search.sh [--agent-id <agent-id|user>] [--from <id>] [--to <id>] [--type <type>]
+#                       [--text <text>] [--since <2d|12h|YYYY-MM-DD>] [--until <...>]
+#                       [--thread <thread-id>] [--limit <n>]
+# <id> may be a session ID, user, alias:<alias>, role:<role> or a bare alias.
+# Prints matching messages as a JSON array, newest first.
 set -euo pipefail
 
-AGENT_ID=""
-PATTERN=""
-DATE=""
+usage="usage: mail_search.sh [--agent-id <agent-id|user>] [--from <id>] [--to <id>] [--type <type>] [--text <text>] [--since <2d|12h|YYYY-MM-DD>] [--until <...>] [--thread <thread-id>] [--limit <n>]"
 
+terms=()
 while [[ $# -gt 0 ]]; do
     case "$1" in
-        --agent-id) AGENT_ID="$2"; shift 2 ;;
-        --pattern)  PATTERN="$2";  shift 2 ;;
-        --date)     DATE="$2";     shift 2 ;;
-        *) echo "unknown argument: $1" >&2; exit 1 ;;
+        --agent-id) terms+=("participant=\"$2\""); shift 2 ;;
+        --from)     terms+=("from=\"$2\"");        shift 2 ;;
+        --to)       terms+=("to=\"$2\"");          shift 2 ;;
+        --type)     terms+=("type=\"$2\"");        shift 2 ;;
+        --text)     terms+=("text=\"$2\"");        shift 2 ;;
+        --since)    terms+=("since=\"$2\"");       shift 2 ;;
+        --until)    terms+=("until=\"$2\"");       shift 2 ;;
+        --thread)   terms+=("thread=\"$2\"");      shift 2 ;;
+        --limit)    terms+=("limit=\"$2\"");       shift 2 ;;
+        *) echo "unknown argument: $1" >&2; echo "$usage" >&2; exit 1 ;;
     esac
 done
 
-if [[ -z "$AGENT_ID" ]] || [[ -z "$PATTERN" ]]; then
-    echo "usage: mail_search.sh --agent-id <agent-id|user> --pattern <regex> [--date YYYYMMdd]" >&2
+if [[ ${#terms[@]} -eq 0 ]]; then
+    echo "$usage" >&2
     exit 1
 fi
 
-MAIL_DIR="$HOME/.local/share/anvillm/mail/$AGENT_ID"
+ANVILLM="${ANVILLM_9MOUNT:-$HOME/mnt/anvillm}"
 
-shopt -s nullglob
-if [[ -n "$DATE" ]]; then
-    SENT="$MAIL_DIR/${DATE}-sent.jsonl"
-    RECV="$MAIL_DIR/${DATE}-recv.jsonl"
-    FILES=()
-    [[ -f "$SENT" ]] && FILES+=("$SENT")
-    [[ -f "$RECV" ]] && FILES+=("$RECV")
-else
-    FILES=("$MAIL_DIR"/*-sent.jsonl "$MAIL_DIR"/*-recv.jsonl)
-fi
-shopt -u nullglob
-
-if [[ ${#FILES[@]} -eq 0 ]]; then
-    exit 0
-fi
-
-cat "${FILES[@]}" | grep -E "$PATTERN"
+# The query and its results go through the same open file
+exec 3<>"$ANVILLM/mail/query"
+printf '%s\n' "${terms[*]}" >&3
+cat <&3
+exec 3<&-
@@ -1,7 +1,7 @@
 #!/bin/bash
 # capabilities: messaging
 # description: Send message to agent or user (FROM uses $AGENT_ID)
-# Usage: send_message.sh --to <id|user> --type <type> --subject <subject> --body <body>
+# Usage: send_message.sh --to <id|user|alias:NAME|role:NAME|cwd:PATH|all[:role:NAME|:cwd:PATH]|topic:NAME> --type <type> --subject <subject> --body <body> [--priority low|normal|high|urgent] [--receipt] [--in-reply-to MSG_ID] [--expects-response SECONDS] [--attach FILE]...
 set -euo pipefail
 
 if [ -z "${AGENT_ID:-}" ]; then
@@ -16,6 +16,11 @@ to=""
 type=""
 subject=""
 body=""
+priority=""
+receipt=false
+in_reply_to=""
+response_timeout=""
+attach=()
 
 while [[ $# -gt 0 ]]; do
     case "$1" in
@@ -23,30 +28,64 @@ while [[ $# -gt 0 ]]; do
         --type)    type="$2";    shift 2 ;;
         --subject) subject="$2"; shift 2 ;;
         --body)    body="$2";    shift 2 ;;
+        --priority) priority="$2"; shift 2 ;;
+        --receipt) receipt=true; shift ;;
+        --in-reply-to) in_reply_to="$2"; shift 2 ;;
+        --expects-response) response_timeout="$2"; shift 2 ;;
+        --attach) attach+=("$2"); shift 2 ;;
         *) echo "unknown argument: $1" >&2; exit 1 ;;
     esac
 done
 
 if [ -z "$to" ] || [ -z "$type" ] || [ -z "$subject" ] || [ -z "$body" ]; then
-    echo "usage: send_message.sh --to <id|user> --type <type> --subject <subject> --body <body>" >&2
+    echo "usage: send_message.sh --to <id|user|alias:NAME|role:NAME|cwd:PATH|all[:role:NAME|:cwd:PATH]|topic:NAME> --type <type> --subject <subject> --body <body> [--priority low|normal|high|urgent] [--receipt] [--in-reply-to MSG_ID] [--expects-response SECONDS] [--attach FILE]..." >&2
     exit 1
 fi
 
-# Validate recipient exists (allow "user" as a special recipient)
-if [ "$to" != "user" ]; then
+# Validate recipient exists (allow "user", "all" and alias:/role:/cwd:/all:/topic:
+# addresses, which the server resolves)
+if [ "$to" != "user" ] && [ "$to" != "all" ] && [[ "$to" != *:* ]]; then
   if ! cat "$ANVILLM/list" 2>/dev/null | awk -F'\t' '{print $1}' | grep -qx "$to"; then
     echo "Error: Recipient '${to}' does not exist in available sessions." >&2
     exit 1
   fi
 fi
 
+# Attachments are sent base64-encoded; the server stores them and recipients
+# read them from their attachments/ directory. Built via temp files because
+# large contents would exceed the argument size limit.
+tmpdir=$(mktemp -d)
+trap 'rm -rf "$tmpdir"' EXIT
+echo '[]' > "$tmpdir/attachments.json"
+for f in ${attach[@]+"${attach[@]}"}; do
+  if [ ! -f "$f" ]; then
+    echo "Error: attachment '${f}' is not a file." >&2
+    exit 1
+  fi
+  base64 -w0 "$f" > "$tmpdir/content"
+  jq --arg name "$(basename "$f")" --rawfile content "$tmpdir/content" \
+    '. + [{name: $name, encoding: "base64", content: $content}]' \
+    "$tmpdir/attachments.json" > "$tmpdir/next.json"
+  mv "$tmpdir/next.json" "$tmpdir/attachments.json"
+done
+
 json=$(jq -n \
   --arg from "$from" \
   --arg to "$to" \
   --arg type "$type" \
   --arg subject "$subject" \
   --arg body "$body" \
-  '{from: $from, to: $to, type: $type, subject: $subject, body: $body}')
+  --arg priority "$priority" \
+  --argjson receipt "$receipt" \
+  --arg in_reply_to "$in_reply_to" \
+  --arg response_timeout "$response_timeout" \
+  --slurpfile attachments "$tmpdir/attachments.json" \
+  '{from: $from, to: $to, type: $type, subject: $subject, body: $body}
+   + (if $priority != "" then {priority: $priority} else {} end)
+   + (if $receipt then {receipt: true} else {} end)
+   + (if $in_reply_to != "" then {in_reply_to: $in_reply_to} else {} end)
+   + (if $response_timeout != "" then {expects_response: true, response_timeout: ($response_timeout | tonumber)} else {} end)
+   + (if ($attachments[0] | length) > 0 then {attachments: $attachments[0]} else {} end)')
 
 echo "$json" > "$ANVILLM/${from}/mail"
 echo "sent: $type → $to"